@@ -4,6 +4,7 @@ import (
 	"github.com/joho/godotenv"
 	"log"
 	"os"
+	"strconv"
 )
 
 func GetENVByKey(key string) string {
@@ -14,3 +15,13 @@ func GetENVByKey(key string) string {
 
 	return os.Getenv(key)
 }
+
+// GetENVInt reads an integer setting from the environment, falling back to the default when it is missing or invalid
+func GetENVInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+
+	return value
+}
@@ -1,40 +1,138 @@
 package Functions
 
 import (
+	"backend/Config"
 	"backend/Mongo"
+	"backend/Realtime"
 	"backend/Schemas"
 	"context"
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
 	"net/http"
 	"time"
 )
 
-func GetAllCommentsForPost(postId string) (comments []Schemas.Comment, err error) {
+// Maximum nesting level of replies, top-level comments have depth 0
+func maxCommentDepth() int {
+	return Config.GetENVInt("COMMENT_MAX_DEPTH", 5)
+}
+
+// Options for loading the comment thread of a post
+type CommentQuery struct {
+	Sort  string // oldest, newest or most_replies
+	Page  int
+	Limit int // Top-level comments per page, 0 loads all of them
+}
+
+// Mongo sort order for a comment sort mode, unknown modes fall back to oldest first.
+// most_replies puts the comments with the most direct replies first, "top" is its older name.
+func commentSortOrder(sortMode string) bson.D {
+	switch sortMode {
+	case "newest":
+		return bson.D{{Key: "_id", Value: -1}}
+	case "most_replies", "top":
+		return bson.D{{Key: "reply_count", Value: -1}, {Key: "_id", Value: 1}}
+	default:
+		return bson.D{{Key: "_id", Value: 1}}
+	}
+}
+
+// Returns one page of top-level comments for a post with their replies nested beneath them,
+// along with the total number of top-level comments
+func GetAllCommentsForPost(postId string, query CommentQuery) (comments []Schemas.Comment, total int64, err error) {
 	comments = make([]Schemas.Comment, 0)
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	cursor, err := Mongo.GetCollection("melje_district").Find(ctx, bson.M{"post_id": postId})
+	collection := Mongo.GetCollection("melje_district")
+	topLevelFilter := bson.M{"post_id": postId, "parent_id": bson.M{"$exists": false}}
+
+	total, err = collection.CountDocuments(ctx, topLevelFilter)
+	if err != nil {
+		return
+	}
+
+	findOptions := options.Find().SetSort(commentSortOrder(query.Sort))
+	if query.Limit > 0 {
+		page := query.Page
+		if page < 1 {
+			page = 1
+		}
+		findOptions.SetSkip(int64((page - 1) * query.Limit)).SetLimit(int64(query.Limit))
+	}
+
+	topLevel, err := findComments(ctx, topLevelFilter, findOptions)
+	if err != nil || len(topLevel) == 0 {
+		return
+	}
+
+	rootIds := make([]string, 0, len(topLevel))
+	for _, comment := range topLevel {
+		rootIds = append(rootIds, comment.ID.Hex())
+	}
+
+	replies, err := findComments(ctx, bson.M{"post_id": postId, "path.0": bson.M{"$in": rootIds}}, options.Find().SetSort(commentSortOrder(query.Sort)))
 	if err != nil {
 		return
 	}
+
+	comments = buildCommentTree(topLevel, replies)
+	return
+}
+
+func findComments(ctx context.Context, filter bson.M, findOptions *options.FindOptions) ([]Schemas.Comment, error) {
+	comments := make([]Schemas.Comment, 0)
+
+	cursor, err := Mongo.GetCollection("melje_district").Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
 	defer cursor.Close(ctx)
 
 	for cursor.Next(ctx) {
 		var comment Schemas.Comment
-		err := cursor.Decode(&comment)
-		if err == nil {
-			comments = append(comments, comment)
+		if err := cursor.Decode(&comment); err != nil {
+			return nil, err
 		}
+		comments = append(comments, comment)
 	}
 
-	/*if err := cursor.Err(); err != nil {
-		return
-	}*/
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
 
-	return
+	return comments, nil
+}
+
+// Nests replies under their parents keeping the order they were loaded in,
+// replies whose parent no longer exists are dropped
+func buildCommentTree(topLevel []Schemas.Comment, replies []Schemas.Comment) []Schemas.Comment {
+	children := make(map[string][]Schemas.Comment)
+	for _, reply := range replies {
+		children[reply.ParentId] = append(children[reply.ParentId], reply)
+	}
+
+	var attach func(comment Schemas.Comment) Schemas.Comment
+	attach = func(comment Schemas.Comment) Schemas.Comment {
+		comment.Replies = make([]Schemas.Comment, 0, len(children[comment.ID.Hex()]))
+		for _, reply := range children[comment.ID.Hex()] {
+			comment.Replies = append(comment.Replies, attach(reply))
+		}
+		return comment
+	}
+
+	tree := make([]Schemas.Comment, 0, len(topLevel))
+	for _, comment := range topLevel {
+		tree = append(tree, attach(comment))
+	}
+
+	return tree
 }
 
 func CreateComment(c *gin.Context) {
@@ -44,15 +142,196 @@ func CreateComment(c *gin.Context) {
 		return
 	}
 
-	_, err := Mongo.GetCollection("melje_district").InsertOne(c, comment)
+	// Thread position is always derived from the parent, never taken from the client
+	comment.Path = []string{}
+	comment.Depth = 0
+	comment.ReplyCount = 0
+	comment.EditedAt = nil
+
+	var parent Schemas.Comment
+	if comment.ParentId != "" {
+		parentObjId, err := primitive.ObjectIDFromHex(comment.ParentId)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid parent_id"})
+			return
+		}
+
+		err = Mongo.GetCollection("melje_district").FindOne(c, bson.M{"_id": parentObjId}).Decode(&parent)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusNotFound, gin.H{"message": "Parent comment not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving parent comment"})
+			return
+		}
+
+		if parent.PostId != comment.PostId {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Parent comment belongs to a different post"})
+			return
+		}
+
+		if parent.Depth+1 > maxCommentDepth() {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Maximum reply depth reached"})
+			return
+		}
+
+		comment.Path = append(append([]string{}, parent.Path...), parent.ID.Hex())
+		comment.Depth = parent.Depth + 1
+	}
+
+	mentions, err := resolveMentions(c, comment.Username, comment.Description)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error resolving mentions"})
+		return
+	}
+	comment.Mentions = mentions
+
+	result, err := Mongo.GetCollection("melje_district").InsertOne(c, comment)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating comment"})
 		return
 	}
 
+	comment.ID = result.InsertedID.(primitive.ObjectID)
+	commentId := comment.ID.Hex()
+	notifyMentions(c, comment.Username, comment.Mentions, comment.PostId, commentId)
+
+	if comment.ParentId != "" {
+		_, err = Mongo.GetCollection("melje_district").UpdateOne(c, bson.M{"_id": parent.ID}, bson.M{"$inc": bson.M{"reply_count": 1}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating reply count"})
+			return
+		}
+	}
+
+	notifyCommentCreated(c, comment, commentId, parent.Username)
+	Realtime.Emit(Realtime.Event{Type: Realtime.EventComment, PostId: comment.PostId, Data: comment})
+
 	c.JSON(http.StatusOK, gin.H{"message": "Comment added successfully"})
 }
 
+// Lets the author of the replied-to comment and the author of the post know about a new comment,
+// each user is notified at most once
+func notifyCommentCreated(ctx context.Context, comment Schemas.Comment, commentId string, parentAuthor string) {
+	notified := make(map[string]bool)
+	for _, username := range comment.Mentions {
+		notified[username] = true
+	}
+
+	if parentAuthor != "" && !notified[parentAuthor] {
+		notified[parentAuthor] = true
+		err := createNotification(ctx, Schemas.Notification{
+			Username:  parentAuthor,
+			Type:      Schemas.NotificationCommentReply,
+			Actor:     comment.Username,
+			Message:   fmt.Sprintf("%s replied to your comment", comment.Username),
+			PostId:    comment.PostId,
+			CommentId: commentId,
+		})
+		if err != nil {
+			log.Printf("(notifyCommentCreated) Error notifying %s: %v", parentAuthor, err)
+		}
+	}
+
+	postObjId, err := primitive.ObjectIDFromHex(comment.PostId)
+	if err != nil {
+		return
+	}
+
+	var post Schemas.Post
+	if err := Mongo.GetCollection("studenci_district").FindOne(ctx, bson.M{"_id": postObjId}).Decode(&post); err != nil {
+		return
+	}
+
+	if notified[post.Username] {
+		return
+	}
+
+	err = createNotification(ctx, Schemas.Notification{
+		Username:  post.Username,
+		Type:      Schemas.NotificationCommentOnPost,
+		Actor:     comment.Username,
+		Message:   fmt.Sprintf("%s commented on your post", comment.Username),
+		PostId:    comment.PostId,
+		CommentId: commentId,
+	})
+	if err != nil {
+		log.Printf("(notifyCommentCreated) Error notifying %s: %v", post.Username, err)
+	}
+}
+
+func EditComment(c *gin.Context) {
+	var edit struct {
+		CommentId   string `json:"comment_id"`
+		Username    string `json:"username"`
+		Description string `json:"description"`
+	}
+
+	if err := c.ShouldBindJSON(&edit); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request"})
+		return
+	}
+
+	if edit.CommentId == "" || edit.Username == "" || edit.Description == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "comment_id, username and description are required"})
+		return
+	}
+
+	objId, err := primitive.ObjectIDFromHex(edit.CommentId)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid comment_id"})
+		return
+	}
+
+	var comment Schemas.Comment
+	err = Mongo.GetCollection("melje_district").FindOne(c, bson.M{"_id": objId}).Decode(&comment)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Comment not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving comment"})
+		return
+	}
+
+	if comment.Username != edit.Username {
+		c.JSON(http.StatusForbidden, gin.H{"message": "You are not authorized to edit this comment"})
+		return
+	}
+
+	mentions, err := resolveMentions(c, comment.Username, edit.Description)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error resolving mentions"})
+		return
+	}
+
+	editedAt := time.Now()
+	_, err = Mongo.GetCollection("melje_district").UpdateOne(c,
+		bson.M{"_id": objId},
+		bson.M{"$set": bson.M{"description": edit.Description, "mentions": mentions, "edited_at": editedAt}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error editing comment"})
+		return
+	}
+
+	// Only users who were not already mentioned before the edit get notified
+	alreadyMentioned := make(map[string]bool)
+	for _, username := range comment.Mentions {
+		alreadyMentioned[username] = true
+	}
+	newMentions := make([]string, 0)
+	for _, username := range mentions {
+		if !alreadyMentioned[username] {
+			newMentions = append(newMentions, username)
+		}
+	}
+	notifyMentions(c, comment.Username, newMentions, comment.PostId, edit.CommentId)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Comment edited successfully", "edited_at": editedAt.Format(time.RFC3339)})
+}
+
 func DeleteComment(c *gin.Context) {
 	commentId := c.Query("comment_id")
 	if commentId == "" {
@@ -62,11 +341,57 @@ func DeleteComment(c *gin.Context) {
 
 	objId, _ := primitive.ObjectIDFromHex(commentId)
 
-	_, err := Mongo.GetCollection("melje_district").DeleteOne(c, bson.M{"_id": objId})
+	var comment Schemas.Comment
+	err := Mongo.GetCollection("melje_district").FindOne(c, bson.M{"_id": objId}).Decode(&comment)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Comment not found"})
+		return
+	}
+
+	// The replies beneath the comment go with it, their reports are closed as well
+	subtree := bson.M{"$or": bson.A{
+		bson.M{"_id": objId},
+		bson.M{"path": commentId},
+	}}
+	cursor, err := Mongo.GetCollection("melje_district").Find(c, subtree, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving replies"})
+		return
+	}
+	var deleted []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(c, &deleted); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error decoding replies"})
+		return
+	}
+	deletedIds := make([]string, 0, len(deleted))
+	for _, reply := range deleted {
+		deletedIds = append(deletedIds, reply.ID.Hex())
+	}
+
+	_, err = Mongo.GetCollection("melje_district").DeleteMany(c, subtree)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error deleting comment"})
 		return
 	}
 
+	if err := closeReports(c, Schemas.ReportComment, deletedIds...); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error closing reports"})
+		return
+	}
+
+	if comment.ParentId != "" {
+		parentObjId, _ := primitive.ObjectIDFromHex(comment.ParentId)
+		_, err = Mongo.GetCollection("melje_district").UpdateOne(c,
+			bson.M{"_id": parentObjId, "reply_count": bson.M{"$gt": 0}},
+			bson.M{"$inc": bson.M{"reply_count": -1}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating reply count"})
+			return
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Comment deleted successfully"})
 }
@@ -0,0 +1,64 @@
+package Functions
+
+import (
+	"backend/Mongo"
+	"backend/Realtime"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Streams new posts, comments on the viewed post and the user's notifications as Server-Sent Events
+func StreamEvents(c *gin.Context) {
+	// EventSource cannot send headers, so the credentials from login travel as query parameters
+	userID := c.Query("user_id")
+	username := c.Query("username")
+	if userID == "" || username == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "user_id and username are required"})
+		return
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid user_id format"})
+		return
+	}
+
+	count, err := Mongo.GetCollection("users").CountDocuments(c, bson.M{"_id": userObjectID, "username": username})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error verifying user"})
+		return
+	}
+	if count == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid user"})
+		return
+	}
+
+	subscriber := Realtime.Subscribe(username, c.Query("post_id"))
+	defer Realtime.Unsubscribe(subscriber)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	heartbeat := time.NewTicker(30 * time.Second)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case event := <-subscriber.Events:
+			c.SSEvent(event.Type, event)
+			return true
+		case <-heartbeat.C:
+			c.SSEvent("ping", gin.H{"time": time.Now().Format(time.RFC3339)})
+			return true
+		}
+	})
+}
@@ -0,0 +1,84 @@
+package Functions
+
+import (
+	"backend/Mongo"
+	"backend/Schemas"
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@([A-Za-z0-9_](?:[A-Za-z0-9_.\-]*[A-Za-z0-9_])?)`)
+
+// Resolves @username mentions in text against the users collection. Unknown usernames,
+// the author themselves and users who have blocked the author are left as plain text.
+func resolveMentions(ctx context.Context, author string, text string) ([]string, error) {
+	mentions := make([]string, 0)
+
+	candidates := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		username := match[1]
+		if username == author || seen[username] {
+			continue
+		}
+		seen[username] = true
+		candidates = append(candidates, username)
+	}
+
+	if len(candidates) == 0 {
+		return mentions, nil
+	}
+
+	cursor, err := Mongo.GetCollection("users").Find(ctx, bson.M{
+		"username": bson.M{"$in": candidates},
+		"blocked":  bson.M{"$ne": author},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	found := make(map[string]bool)
+	for cursor.Next(ctx) {
+		var user Schemas.User
+		if err := cursor.Decode(&user); err != nil {
+			return nil, err
+		}
+		found[user.Name] = true
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	// Keep the order in which users were mentioned
+	for _, username := range candidates {
+		if found[username] {
+			mentions = append(mentions, username)
+		}
+	}
+
+	return mentions, nil
+}
+
+// Notifies every mentioned user, failures are logged so they never undo the post or comment
+func notifyMentions(ctx context.Context, author string, mentions []string, postId string, commentId string) {
+	for _, username := range mentions {
+		notification := Schemas.Notification{
+			Username:  username,
+			Type:      Schemas.NotificationMention,
+			Actor:     author,
+			Message:   fmt.Sprintf("%s mentioned you", author),
+			PostId:    postId,
+			CommentId: commentId,
+		}
+
+		if err := createNotification(ctx, notification); err != nil {
+			log.Printf("(notifyMentions) Error notifying %s: %v", username, err)
+		}
+	}
+}
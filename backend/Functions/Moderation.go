@@ -0,0 +1,563 @@
+package Functions
+
+import (
+	"backend/Mongo"
+	"backend/Schemas"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	maxModerationReasonLength = 1000
+	maxAppealMessageLength    = 2000
+)
+
+// What the uploader is told for every decision
+var moderationMessages = map[string]string{
+	Schemas.ModerationRestore: "The flags on your video have been cleared",
+	Schemas.ModerationRemove:  "A moderator removed your video",
+	Schemas.ModerationWarn:    "A moderator warned you about your video",
+	Schemas.ModerationBan:     "A moderator banned your account over your video",
+}
+
+// A flagged video waiting for a decision
+type ModerationQueueItem struct {
+	Video     VideoListItem  `json:"video"`
+	FlagScore float64        `json:"flag_score"`
+	Hidden    bool           `json:"hidden"`
+	Reasons   map[string]int `json:"reasons"`
+}
+
+// An open appeal with the decision it is against
+type ModerationAppealItem struct {
+	Schemas.ModerationAppeal `bson:",inline"`
+	Video                    Schemas.Video              `json:"video" bson:"video"`
+	Decision                 Schemas.ModerationDecision `json:"decision" bson:"decision"`
+}
+
+// Loads the moderator making a request, when ok is false the error response is already written
+func moderatorUser(c *gin.Context, username string) (Schemas.User, bool) {
+	if username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "admin_username is required"})
+		return Schemas.User{}, false
+	}
+
+	user, err := getUserByUsername(c, username)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Admin user not found"})
+			return Schemas.User{}, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving user data"})
+		return Schemas.User{}, false
+	}
+	if !user.Admin {
+		c.JSON(http.StatusForbidden, gin.H{"message": "You are not authorized to moderate content"})
+		return Schemas.User{}, false
+	}
+
+	return user, true
+}
+
+// Counts the flags that still count per video and reason
+func flagReasonCounts(ctx context.Context, videoIDs []string) (map[string]map[string]int, error) {
+	counts := make(map[string]map[string]int)
+	if len(videoIDs) == 0 {
+		return counts, nil
+	}
+
+	cursor, err := Mongo.GetCollection("videostore_flags").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"video_id": bson.M{"$in": videoIDs}, "cleared": false}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"video_id": "$video_id", "reason": "$reason"},
+			"count": bson.M{"$sum": 1},
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var result struct {
+			ID struct {
+				VideoId string `bson:"video_id"`
+				Reason  string `bson:"reason"`
+			} `bson:"_id"`
+			Count int `bson:"count"`
+		}
+		if err := cursor.Decode(&result); err != nil {
+			return nil, err
+		}
+		if counts[result.ID.VideoId] == nil {
+			counts[result.ID.VideoId] = make(map[string]int)
+		}
+		counts[result.ID.VideoId][result.ID.Reason] = result.Count
+	}
+
+	return counts, cursor.Err()
+}
+
+// Records a moderation decision in the audit log, applies it and tells the uploader. An open appeal
+// on the video is resolved by the decision, and reopened when applying it fails.
+// When ok is false the error response is already written.
+func applyModerationDecision(c *gin.Context, moderator Schemas.User, video Schemas.Video, action string, reason string) (decision Schemas.ModerationDecision, ok bool) {
+	appeals := Mongo.GetCollection("moderation_appeals")
+
+	var appeal Schemas.ModerationAppeal
+	err := appeals.FindOne(c, bson.M{"video_id": video.VideoID, "status": Schemas.AppealOpen}).Decode(&appeal)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving appeals"})
+		return
+	}
+	hasAppeal := err == nil
+	if hasAppeal && appeal.DecidedBy == moderator.Name {
+		c.JSON(http.StatusForbidden, gin.H{"message": "An appeal must be decided by a different moderator"})
+		return
+	}
+
+	reasons, err := flagReasonCounts(c, []string{video.VideoID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving flags"})
+		return
+	}
+
+	decision = Schemas.ModerationDecision{
+		ID:          primitive.NewObjectID(),
+		TargetType:  Schemas.ReportVideo,
+		TargetId:    video.VideoID,
+		VideoId:     video.VideoID,
+		Uploader:    video.Uploader,
+		Moderator:   moderator.Name,
+		Action:      action,
+		Reason:      reason,
+		FlagScore:   videoFlagScore(video),
+		FlagReasons: reasons[video.VideoID],
+		CreatedAt:   time.Now(),
+	}
+
+	// Claiming the appeal first keeps two moderators from deciding it at once
+	if hasAppeal {
+		now := time.Now()
+		result, err := appeals.UpdateOne(c,
+			bson.M{"_id": appeal.ID, "status": Schemas.AppealOpen},
+			bson.M{"$set": bson.M{
+				"status":        Schemas.AppealResolved,
+				"resolution_id": decision.ID.Hex(),
+				"resolved_by":   moderator.Name,
+				"resolved_at":   now,
+			}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error resolving appeal"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusConflict, gin.H{"message": "The appeal has already been decided"})
+			return
+		}
+		decision.AppealId = appeal.ID
+	}
+
+	// A claimed appeal goes back to the queue when the decision can not be carried out
+	reopenAppeal := func() {
+		if !hasAppeal {
+			return
+		}
+		_, err := appeals.UpdateOne(context.Background(),
+			bson.M{"_id": appeal.ID, "resolution_id": decision.ID.Hex()},
+			bson.M{
+				"$set":   bson.M{"status": Schemas.AppealOpen},
+				"$unset": bson.M{"resolution_id": "", "resolved_by": "", "resolved_at": ""},
+			},
+		)
+		if err != nil {
+			log.Printf("(applyModerationDecision) Error reopening appeal %s: %v", appeal.ID, err)
+		}
+	}
+
+	// The decision is recorded before it is applied, so nothing changes without an audit entry
+	_, err = Mongo.GetCollection("moderation_log").InsertOne(c, decision)
+	if err != nil {
+		reopenAppeal()
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error recording decision", "error": err.Error()})
+		return
+	}
+
+	// Every decision settles the current flags
+	videoUpdate := bson.M{"flagged": 0, "flag_score": 0}
+	userUpdate := bson.M{}
+	switch action {
+	case Schemas.ModerationRestore:
+		videoUpdate["removed"] = false
+		// Winning the appeal against a ban lifts it
+		if hasAppeal && appeal.Action == Schemas.ModerationBan {
+			userUpdate["$set"] = bson.M{"banned": false}
+		}
+	case Schemas.ModerationRemove:
+		videoUpdate["removed"] = true
+	case Schemas.ModerationWarn:
+		userUpdate["$inc"] = bson.M{"warnings": 1}
+	case Schemas.ModerationBan:
+		videoUpdate["removed"] = true
+		userUpdate["$set"] = bson.M{"banned": true}
+	}
+
+	_, err = Mongo.GetCollection("videostore").UpdateOne(c, bson.M{"video_id": video.VideoID}, bson.M{"$set": videoUpdate})
+	if err != nil {
+		reopenAppeal()
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating video", "error": err.Error()})
+		return
+	}
+
+	_, err = Mongo.GetCollection("videostore_flags").UpdateMany(c, bson.M{"video_id": video.VideoID}, bson.M{"$set": bson.M{"cleared": true}})
+	if err != nil {
+		reopenAppeal()
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error clearing flags", "error": err.Error()})
+		return
+	}
+
+	if err := closeReports(c, Schemas.ReportVideo, video.VideoID); err != nil {
+		reopenAppeal()
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error closing reports", "error": err.Error()})
+		return
+	}
+
+	if len(userUpdate) > 0 {
+		_, err = Mongo.GetCollection("users").UpdateOne(c, bson.M{"username": video.Uploader}, userUpdate)
+		if err != nil {
+			reopenAppeal()
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating uploader", "error": err.Error()})
+			return
+		}
+	}
+
+	notificationType := Schemas.NotificationModeration
+	if action == Schemas.ModerationRestore {
+		notificationType = Schemas.NotificationVideoFlagReset
+	}
+	notifyUploader(c, video.VideoID, notificationType, moderator.Name, fmt.Sprintf("%s (%s)", moderationMessages[action], reason))
+
+	return decision, true
+}
+
+type ModerationDecisionRequest struct {
+	AdminUsername string `json:"admin_username"`
+	VideoID       string `json:"video_id"`
+	Action        string `json:"action"`
+	Reason        string `json:"reason"`
+}
+
+// Decides on a flagged or appealed video
+func DecideModeration(c *gin.Context) {
+	var request ModerationDecisionRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request"})
+		return
+	}
+
+	decideVideo(c, request)
+}
+
+// Validates and applies a decision on a video, also used for video reports
+func decideVideo(c *gin.Context, request ModerationDecisionRequest) {
+	request.Reason = strings.TrimSpace(request.Reason)
+	if request.VideoID == "" || request.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "video_id and reason are required"})
+		return
+	}
+	if utf8.RuneCountInString(request.Reason) > maxModerationReasonLength {
+		c.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("reason must be at most %d characters", maxModerationReasonLength)})
+		return
+	}
+	if _, known := moderationMessages[request.Action]; !known {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Unknown action: " + request.Action, "actions": Schemas.ModerationActions})
+		return
+	}
+
+	moderator, ok := moderatorUser(c, request.AdminUsername)
+	if !ok {
+		return
+	}
+
+	var video Schemas.Video
+	err := Mongo.GetCollection("videostore").FindOne(c, bson.M{"video_id": request.VideoID}).Decode(&video)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Video not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving video metadata"})
+		return
+	}
+
+	decision, ok := applyModerationDecision(c, moderator, video, request.Action, request.Reason)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Decision recorded", "decision": decision})
+}
+
+// Lists flagged videos with their flag reasons, highest score first, and the open appeals
+// the moderator may decide
+func GetModerationQueue(c *gin.Context) {
+	moderator, ok := moderatorUser(c, c.Query("admin_username"))
+	if !ok {
+		return
+	}
+
+	collection := Mongo.GetCollection("videostore")
+	filter := bson.M{"flagged": bson.M{"$gt": 0}, "removed": bson.M{"$ne": true}}
+
+	total, err := collection.CountDocuments(c, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error counting flagged videos"})
+		return
+	}
+
+	page, limit := getPagination(c, "page", "limit", 20)
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "flag_score", Value: -1}, {Key: "flagged", Value: -1}, {Key: "posted_at", Value: 1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit))
+
+	cursor, err := collection.Find(c, filter, findOptions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error querying flagged videos"})
+		return
+	}
+	defer cursor.Close(c)
+
+	videos := make([]Schemas.Video, 0)
+	if err := cursor.All(c, &videos); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error decoding flagged videos"})
+		return
+	}
+
+	videoIDs := make([]string, 0, len(videos))
+	for _, video := range videos {
+		videoIDs = append(videoIDs, video.VideoID)
+	}
+	reasons, err := flagReasonCounts(c, videoIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving flags"})
+		return
+	}
+
+	threshold := flagHideThreshold()
+	queue := make([]ModerationQueueItem, 0, len(videos))
+	for _, video := range videos {
+		score := videoFlagScore(video)
+		item := ModerationQueueItem{Video: newVideoListItem(video), FlagScore: score, Hidden: score >= threshold, Reasons: reasons[video.VideoID]}
+		if item.Reasons == nil {
+			item.Reasons = map[string]int{}
+		}
+		queue = append(queue, item)
+	}
+
+	appeals, err := openAppeals(c, moderator, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving appeals"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"videos":  queue,
+		"appeals": appeals,
+		"total":   total,
+		"page":    page,
+		"limit":   limit,
+	})
+}
+
+// Loads the oldest open appeals the moderator did not make the appealed decision for. Videos and
+// decisions are joined in the query, so appeals on deleted videos do not take up the limit.
+func openAppeals(ctx context.Context, moderator Schemas.User, limit int) ([]ModerationAppealItem, error) {
+	cursor, err := Mongo.GetCollection("moderation_appeals").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"status": Schemas.AppealOpen, "decided_by": bson.M{"$ne": moderator.Name}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "created_at", Value: 1}}}},
+		{{Key: "$lookup", Value: bson.M{"from": "videostore", "localField": "video_id", "foreignField": "video_id", "as": "video"}}},
+		{{Key: "$unwind", Value: "$video"}},
+		{{Key: "$limit", Value: limit}},
+		// The appeal id is the hex of the decision id
+		{{Key: "$lookup", Value: bson.M{
+			"from":     "moderation_log",
+			"let":      bson.M{"decision_id": bson.M{"$toObjectId": "$_id"}},
+			"pipeline": bson.A{bson.M{"$match": bson.M{"$expr": bson.M{"$eq": bson.A{"$_id", "$$decision_id"}}}}},
+			"as":       "decision",
+		}}},
+		{{Key: "$unwind", Value: "$decision"}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	items := make([]ModerationAppealItem, 0)
+	for cursor.Next(ctx) {
+		var item ModerationAppealItem
+		if err := cursor.Decode(&item); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, cursor.Err()
+}
+
+// Closes the open appeals on a deleted video, there is nothing left to decide
+func closeAppeals(ctx context.Context, videoID string) error {
+	_, err := Mongo.GetCollection("moderation_appeals").UpdateMany(ctx,
+		bson.M{"video_id": videoID, "status": Schemas.AppealOpen},
+		bson.M{"$set": bson.M{"status": Schemas.AppealClosed, "resolved_at": time.Now()}},
+	)
+	return err
+}
+
+// Lists the audit log, newest first, optionally for one video or moderator
+func GetModerationLog(c *gin.Context) {
+	if _, ok := moderatorUser(c, c.Query("admin_username")); !ok {
+		return
+	}
+
+	filter := bson.M{}
+	if videoID := c.Query("video_id"); videoID != "" {
+		filter["video_id"] = videoID
+	}
+	if moderator := c.Query("moderator"); moderator != "" {
+		filter["moderator"] = moderator
+	}
+
+	collection := Mongo.GetCollection("moderation_log")
+	total, err := collection.CountDocuments(c, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error counting decisions"})
+		return
+	}
+
+	page, limit := getPagination(c, "page", "limit", 50)
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit))
+
+	cursor, err := collection.Find(c, filter, findOptions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving decisions"})
+		return
+	}
+	defer cursor.Close(c)
+
+	decisions := make([]Schemas.ModerationDecision, 0)
+	if err := cursor.All(c, &decisions); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error decoding decisions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"decisions": decisions,
+		"total":     total,
+		"page":      page,
+		"limit":     limit,
+	})
+}
+
+type AppealRequest struct {
+	Username string `json:"username"`
+	VideoID  string `json:"video_id"`
+	Message  string `json:"message"`
+}
+
+// Lets the uploader appeal the latest decision on their video, which puts the video back in the
+// queue for a different moderator. Every decision can be appealed once and appeal outcomes are final.
+func CreateAppeal(c *gin.Context) {
+	var request AppealRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request"})
+		return
+	}
+
+	request.Message = strings.TrimSpace(request.Message)
+	if request.Username == "" || request.VideoID == "" || request.Message == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "username, video_id and message are required"})
+		return
+	}
+	if utf8.RuneCountInString(request.Message) > maxAppealMessageLength {
+		c.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("message must be at most %d characters", maxAppealMessageLength)})
+		return
+	}
+
+	var video Schemas.Video
+	err := Mongo.GetCollection("videostore").FindOne(c, bson.M{"video_id": request.VideoID}).Decode(&video)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Video not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving video metadata"})
+		return
+	}
+	if video.Uploader != request.Username {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Only the uploader can appeal decisions on a video"})
+		return
+	}
+
+	var decision Schemas.ModerationDecision
+	err = Mongo.GetCollection("moderation_log").FindOne(c,
+		bson.M{"video_id": request.VideoID},
+		options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}}),
+	).Decode(&decision)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "There is no decision to appeal"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving decisions"})
+		return
+	}
+	if decision.Action == Schemas.ModerationRestore {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Restored videos can not be appealed"})
+		return
+	}
+	if decision.AppealId != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "This decision was made on appeal and is final"})
+		return
+	}
+
+	appeal := Schemas.ModerationAppeal{
+		ID:        decision.ID.Hex(),
+		VideoId:   video.VideoID,
+		Uploader:  video.Uploader,
+		Message:   request.Message,
+		Action:    decision.Action,
+		DecidedBy: decision.Moderator,
+		Status:    Schemas.AppealOpen,
+		CreatedAt: time.Now(),
+	}
+
+	// The appeal id is the decision id, so a decision can only be appealed once
+	_, err = Mongo.GetCollection("moderation_appeals").InsertOne(c, appeal)
+	if mongo.IsDuplicateKeyError(err) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "This decision has already been appealed"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating appeal"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Appeal submitted successfully", "appeal": appeal})
+}
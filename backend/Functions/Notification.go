@@ -0,0 +1,259 @@
+package Functions
+
+import (
+	"backend/Mongo"
+	"backend/Realtime"
+	"backend/Schemas"
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Stores a new unread notification unless the recipient has switched that type off
+func createNotification(ctx context.Context, notification Schemas.Notification) error {
+	if notification.Username == "" || notification.Username == notification.Actor {
+		return nil
+	}
+
+	var recipient Schemas.User
+	err := Mongo.GetCollection("users").FindOne(ctx, bson.M{"username": notification.Username}).Decode(&recipient)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil
+		}
+		return err
+	}
+
+	if enabled, ok := recipient.NotificationPreferences[notification.Type]; ok && !enabled {
+		return nil
+	}
+
+	notification.Read = false
+	notification.CreatedAt = time.Now()
+
+	result, err := Mongo.GetCollection("notifications").InsertOne(ctx, notification)
+	if err != nil {
+		return err
+	}
+
+	notification.ID = result.InsertedID.(primitive.ObjectID)
+	Realtime.Emit(Realtime.Event{Type: Realtime.EventNotification, Username: notification.Username, Data: notification})
+	return nil
+}
+
+func GetNotifications(c *gin.Context) {
+	username := c.Query("username")
+	if username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "username is required"})
+		return
+	}
+
+	filter := bson.M{"username": username}
+	if c.Query("unread") == "true" {
+		filter["read"] = false
+	}
+
+	collection := Mongo.GetCollection("notifications")
+	total, err := collection.CountDocuments(c, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error counting notifications"})
+		return
+	}
+
+	page, limit := getPagination(c, "page", "limit", 20)
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit))
+
+	cursor, err := collection.Find(c, filter, findOptions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving notifications"})
+		return
+	}
+	defer cursor.Close(c)
+
+	notifications := make([]Schemas.Notification, 0)
+	if err := cursor.All(c, &notifications); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error decoding notifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"notifications": notifications,
+		"total":         total,
+		"page":          page,
+		"limit":         limit,
+	})
+}
+
+func GetUnreadNotificationCount(c *gin.Context) {
+	username := c.Query("username")
+	if username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "username is required"})
+		return
+	}
+
+	count, err := Mongo.GetCollection("notifications").CountDocuments(c, bson.M{"username": username, "read": false})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error counting notifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"unread": count})
+}
+
+type NotificationReadRequest struct {
+	Username       string `json:"username"`
+	NotificationId string `json:"notification_id"`
+}
+
+func MarkNotificationRead(c *gin.Context) {
+	var request NotificationReadRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request"})
+		return
+	}
+
+	if request.Username == "" || request.NotificationId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "username and notification_id are required"})
+		return
+	}
+
+	objId, err := primitive.ObjectIDFromHex(request.NotificationId)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid notification_id"})
+		return
+	}
+
+	// Scoping the update by username keeps users from touching each other's notifications
+	result, err := Mongo.GetCollection("notifications").UpdateOne(c,
+		bson.M{"_id": objId, "username": request.Username},
+		bson.M{"$set": bson.M{"read": true}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating notification"})
+		return
+	}
+
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Notification not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Notification marked as read"})
+}
+
+func MarkAllNotificationsRead(c *gin.Context) {
+	var request NotificationReadRequest
+	if err := c.ShouldBindJSON(&request); err != nil || request.Username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "username is required"})
+		return
+	}
+
+	result, err := Mongo.GetCollection("notifications").UpdateMany(c,
+		bson.M{"username": request.Username, "read": false},
+		bson.M{"$set": bson.M{"read": true}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating notifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Notifications marked as read", "updated": result.ModifiedCount})
+}
+
+// Fills in every known notification type so clients always see the full set of switches
+func resolvedPreferences(preferences map[string]bool) map[string]bool {
+	resolved := make(map[string]bool, len(Schemas.NotificationTypes))
+	for _, notificationType := range Schemas.NotificationTypes {
+		enabled, ok := preferences[notificationType]
+		resolved[notificationType] = !ok || enabled
+	}
+	return resolved
+}
+
+func GetNotificationPreferences(c *gin.Context) {
+	username := c.Query("username")
+	if username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "username is required"})
+		return
+	}
+
+	var user Schemas.User
+	err := Mongo.GetCollection("users").FindOne(c, bson.M{"username": username}).Decode(&user)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"preferences": resolvedPreferences(user.NotificationPreferences)})
+}
+
+func UpdateNotificationPreferences(c *gin.Context) {
+	var request struct {
+		Username    string          `json:"username"`
+		Preferences map[string]bool `json:"preferences"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request"})
+		return
+	}
+
+	if request.Username == "" || len(request.Preferences) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "username and preferences are required"})
+		return
+	}
+
+	known := make(map[string]bool)
+	for _, notificationType := range Schemas.NotificationTypes {
+		known[notificationType] = true
+	}
+
+	for notificationType := range request.Preferences {
+		if !known[notificationType] {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Unknown notification type: " + notificationType})
+			return
+		}
+	}
+
+	var user Schemas.User
+	err := Mongo.GetCollection("users").FindOne(c, bson.M{"username": request.Username}).Decode(&user)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving user"})
+		return
+	}
+
+	// Older accounts have no preferences document yet, so the whole map is replaced
+	preferences := make(map[string]bool)
+	for notificationType, enabled := range user.NotificationPreferences {
+		preferences[notificationType] = enabled
+	}
+	for notificationType, enabled := range request.Preferences {
+		preferences[notificationType] = enabled
+	}
+
+	_, err = Mongo.GetCollection("users").UpdateOne(c,
+		bson.M{"_id": user.ID},
+		bson.M{"$set": bson.M{"notification_preferences": preferences}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating preferences"})
+		return
+	}
+	user.NotificationPreferences = preferences
+
+	c.JSON(http.StatusOK, gin.H{"message": "Preferences updated successfully", "preferences": resolvedPreferences(user.NotificationPreferences)})
+}
@@ -0,0 +1,27 @@
+package Functions
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxPageSize = 100
+
+// Reads 1-based page and page size query parameters, clamping them to sane values
+func getPagination(c *gin.Context, pageKey string, limitKey string, defaultLimit int) (page int, limit int) {
+	page, err := strconv.Atoi(c.Query(pageKey))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	limit, err = strconv.Atoi(c.Query(limitKey))
+	if err != nil || limit < 1 {
+		limit = defaultLimit
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	return page, limit
+}
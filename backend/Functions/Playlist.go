@@ -0,0 +1,608 @@
+package Functions
+
+import (
+	"backend/Mongo"
+	"backend/Schemas"
+	"backend/Storage"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	maxPlaylistNameLength        = 200
+	maxPlaylistDescriptionLength = 5000
+	maxPlaylistVideos            = 500
+)
+
+// Playlist metadata with the videos the viewer may watch, in playlist order
+type PlaylistResponse struct {
+	Schemas.Playlist
+	Videos []VideoListItem `json:"videos"`
+}
+
+// Iterates over already loaded videos so a playlist can be written with writeVideosZip
+type videoListCursor struct {
+	videos []Schemas.Video
+	index  int
+}
+
+func (cursor *videoListCursor) Next(ctx context.Context) bool {
+	if cursor.index >= len(cursor.videos) {
+		return false
+	}
+	cursor.index++
+	return true
+}
+
+func (cursor *videoListCursor) Decode(val interface{}) error {
+	video, ok := val.(*Schemas.Video)
+	if !ok {
+		return errors.New("videoListCursor can only decode into *Schemas.Video")
+	}
+	*video = cursor.videos[cursor.index-1]
+	return nil
+}
+
+func (cursor *videoListCursor) Err() error {
+	return nil
+}
+
+// Private playlists are only visible to their owner, moderators see every playlist
+func playlistVisibleTo(playlist Schemas.Playlist, viewer *Schemas.User) bool {
+	return playlist.Public || (viewer != nil && (viewer.Name == playlist.Owner || viewer.Admin))
+}
+
+func checkPlaylistDetails(name string, description string) error {
+	if name == "" || utf8.RuneCountInString(name) > maxPlaylistNameLength {
+		return fmt.Errorf("name must have 1 to %d characters", maxPlaylistNameLength)
+	}
+	if utf8.RuneCountInString(description) > maxPlaylistDescriptionLength {
+		return fmt.Errorf("description must be at most %d characters", maxPlaylistDescriptionLength)
+	}
+	return nil
+}
+
+func findPlaylist(ctx context.Context, playlistID string) (Schemas.Playlist, error) {
+	var playlist Schemas.Playlist
+	objId, err := primitive.ObjectIDFromHex(playlistID)
+	if err != nil {
+		return playlist, mongo.ErrNoDocuments
+	}
+
+	err = Mongo.GetCollection("videostore_playlists").FindOne(ctx, bson.M{"_id": objId}).Decode(&playlist)
+	return playlist, err
+}
+
+// Loads a playlist the viewer may see, when ok is false the error response is already written
+func viewablePlaylist(c *gin.Context) (playlist Schemas.Playlist, viewer *Schemas.User, ok bool) {
+	viewer, ok = videoViewer(c)
+	if !ok {
+		return
+	}
+
+	playlist, err := findPlaylist(c, c.Param("playlist_id"))
+	if err == nil && !playlistVisibleTo(playlist, viewer) {
+		err = mongo.ErrNoDocuments
+	}
+	if err != nil {
+		ok = false
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Playlist not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving playlist"})
+		return
+	}
+
+	return playlist, viewer, true
+}
+
+// Loads a playlist for a change, user playlists belong to their owner and course collections
+// to the moderators. When ok is false the error response is already written.
+func authorizePlaylistChange(c *gin.Context, playlistID string, username string) (playlist Schemas.Playlist, user Schemas.User, ok bool) {
+	if username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "username is required"})
+		return
+	}
+
+	user, err := getUserByUsername(c, username)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving user data"})
+		return
+	}
+
+	playlist, err = findPlaylist(c, playlistID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Playlist not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving playlist"})
+		return
+	}
+
+	allowed := playlist.Owner == user.Name
+	if playlist.Kind == Schemas.PlaylistCourse {
+		allowed = user.Admin
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"message": "You are not authorized to change this playlist"})
+		return
+	}
+
+	return playlist, user, true
+}
+
+// Loads the videos of a playlist the viewer may watch, keeping the playlist order
+func playlistVideos(ctx context.Context, playlist Schemas.Playlist, viewer *Schemas.User) ([]Schemas.Video, error) {
+	videos := make([]Schemas.Video, 0, len(playlist.VideoIds))
+	if len(playlist.VideoIds) == 0 {
+		return videos, nil
+	}
+
+	filter := visibleVideoFilter(viewer, false)
+	filter["video_id"] = bson.M{"$in": playlist.VideoIds}
+
+	cursor, err := Mongo.GetCollection("videostore").Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	byID := make(map[string]Schemas.Video)
+	for cursor.Next(ctx) {
+		var video Schemas.Video
+		if err := cursor.Decode(&video); err != nil {
+			return nil, err
+		}
+		byID[video.VideoID] = video
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, videoID := range playlist.VideoIds {
+		if video, found := byID[videoID]; found {
+			videos = append(videos, video)
+		}
+	}
+
+	return videos, nil
+}
+
+// Writes a playlist change and returns the updated playlist. The filter can guard against
+// concurrent changes, when it no longer matches nothing is written.
+func updatePlaylist(c *gin.Context, filter bson.M, set bson.M) {
+	set["updated_at"] = time.Now()
+
+	var updated Schemas.Playlist
+	err := Mongo.GetCollection("videostore_playlists").FindOneAndUpdate(c,
+		filter,
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusConflict, gin.H{"message": "Playlist was changed at the same time, please retry"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating playlist"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Playlist updated successfully", "playlist": updated})
+}
+
+type PlaylistRequest struct {
+	Username    string `json:"username"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Kind        string `json:"kind"` // playlist or course, defaults to playlist
+	Public      bool   `json:"public"`
+}
+
+func CreatePlaylist(c *gin.Context) {
+	var request PlaylistRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request"})
+		return
+	}
+
+	request.Name = strings.TrimSpace(request.Name)
+	if err := checkPlaylistDetails(request.Name, request.Description); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	if request.Kind == "" {
+		request.Kind = Schemas.PlaylistUser
+	}
+	if request.Kind != Schemas.PlaylistUser && request.Kind != Schemas.PlaylistCourse {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "kind must be playlist or course"})
+		return
+	}
+
+	user, err := getUserByUsername(c, request.Username)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving user data"})
+		return
+	}
+
+	if request.Kind == Schemas.PlaylistCourse && !user.Admin {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Only moderators can create course collections"})
+		return
+	}
+
+	now := time.Now()
+	playlist := Schemas.Playlist{
+		ID:          primitive.NewObjectID(),
+		Name:        request.Name,
+		Description: request.Description,
+		Owner:       user.Name,
+		Kind:        request.Kind,
+		Public:      request.Public,
+		VideoIds:    []string{},
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	_, err = Mongo.GetCollection("videostore_playlists").InsertOne(c, playlist)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating playlist"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Playlist created successfully", "playlist": playlist})
+}
+
+// Lists the public playlists and the viewer's own, optionally only one owner's or one kind
+func ListPlaylists(c *gin.Context) {
+	viewer, ok := videoViewer(c)
+	if !ok {
+		return
+	}
+
+	filter := bson.M{}
+	if viewer == nil {
+		filter["public"] = true
+	} else if !viewer.Admin {
+		filter["$or"] = bson.A{bson.M{"public": true}, bson.M{"owner": viewer.Name}}
+	}
+	if owner := c.Query("owner"); owner != "" {
+		filter["owner"] = owner
+	}
+	if kind := c.Query("kind"); kind != "" {
+		filter["kind"] = kind
+	}
+
+	collection := Mongo.GetCollection("videostore_playlists")
+	total, err := collection.CountDocuments(c, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error counting playlists"})
+		return
+	}
+
+	page, limit := getPagination(c, "page", "limit", 20)
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "updated_at", Value: -1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit))
+
+	cursor, err := collection.Find(c, filter, findOptions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving playlists"})
+		return
+	}
+	defer cursor.Close(c)
+
+	playlists := make([]Schemas.Playlist, 0)
+	if err := cursor.All(c, &playlists); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error decoding playlists"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"playlists": playlists,
+		"total":     total,
+		"page":      page,
+		"limit":     limit,
+	})
+}
+
+func GetPlaylist(c *gin.Context) {
+	playlist, viewer, ok := viewablePlaylist(c)
+	if !ok {
+		return
+	}
+
+	videos, err := playlistVideos(c, playlist, viewer)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving playlist videos"})
+		return
+	}
+
+	response := PlaylistResponse{Playlist: playlist, Videos: make([]VideoListItem, 0, len(videos))}
+	for _, video := range videos {
+		response.Videos = append(response.Videos, newVideoListItem(video))
+	}
+
+	if err := attachResumePositions(c, viewer, response.Videos); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving watch progress"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+type PlaylistEditRequest struct {
+	Username    string  `json:"username"`
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	Public      *bool   `json:"public"`
+}
+
+func EditPlaylist(c *gin.Context) {
+	var request PlaylistEditRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request"})
+		return
+	}
+
+	playlist, _, ok := authorizePlaylistChange(c, c.Param("playlist_id"), request.Username)
+	if !ok {
+		return
+	}
+
+	name := playlist.Name
+	if request.Name != nil {
+		name = strings.TrimSpace(*request.Name)
+	}
+	description := playlist.Description
+	if request.Description != nil {
+		description = *request.Description
+	}
+	public := playlist.Public
+	if request.Public != nil {
+		public = *request.Public
+	}
+
+	if err := checkPlaylistDetails(name, description); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	updatePlaylist(c, bson.M{"_id": playlist.ID}, bson.M{"name": name, "description": description, "public": public})
+}
+
+func DeletePlaylist(c *gin.Context) {
+	playlist, _, ok := authorizePlaylistChange(c, c.Param("playlist_id"), c.Query("username"))
+	if !ok {
+		return
+	}
+
+	_, err := Mongo.GetCollection("videostore_playlists").DeleteOne(c, bson.M{"_id": playlist.ID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error deleting playlist"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Playlist deleted successfully"})
+}
+
+type PlaylistVideoRequest struct {
+	Username string `json:"username"`
+	VideoID  string `json:"video_id"`
+	Position *int   `json:"position"` // Zero based, appended to the end when missing
+}
+
+func AddPlaylistVideo(c *gin.Context) {
+	var request PlaylistVideoRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request"})
+		return
+	}
+
+	playlist, user, ok := authorizePlaylistChange(c, c.Param("playlist_id"), request.Username)
+	if !ok {
+		return
+	}
+
+	for _, videoID := range playlist.VideoIds {
+		if videoID == request.VideoID {
+			c.JSON(http.StatusConflict, gin.H{"message": "Video is already in the playlist"})
+			return
+		}
+	}
+	if len(playlist.VideoIds) >= maxPlaylistVideos {
+		c.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("playlists can hold at most %d videos", maxPlaylistVideos)})
+		return
+	}
+
+	// Only videos the editor can open may be added
+	if _, err := findVisibleVideo(c, &user, request.VideoID); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Video not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving video metadata"})
+		return
+	}
+
+	position := len(playlist.VideoIds)
+	if request.Position != nil {
+		if *request.Position < 0 || *request.Position > len(playlist.VideoIds) {
+			c.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("position must be between 0 and %d", len(playlist.VideoIds))})
+			return
+		}
+		position = *request.Position
+	}
+
+	// The size guard keeps concurrent edits from adding the same video twice or exceeding the limit
+	result, err := Mongo.GetCollection("videostore_playlists").UpdateOne(c,
+		bson.M{"_id": playlist.ID, "video_ids": bson.M{"$ne": request.VideoID, "$size": len(playlist.VideoIds)}},
+		bson.M{
+			"$push": bson.M{"video_ids": bson.M{"$each": bson.A{request.VideoID}, "$position": position}},
+			"$set":  bson.M{"updated_at": time.Now()},
+		},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error adding video to playlist"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusConflict, gin.H{"message": "Playlist was changed at the same time, please retry"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Video added to playlist"})
+}
+
+func RemovePlaylistVideo(c *gin.Context) {
+	playlist, _, ok := authorizePlaylistChange(c, c.Param("playlist_id"), c.Query("username"))
+	if !ok {
+		return
+	}
+
+	result, err := Mongo.GetCollection("videostore_playlists").UpdateOne(c,
+		bson.M{"_id": playlist.ID, "video_ids": c.Param("video_id")},
+		bson.M{
+			"$pull": bson.M{"video_ids": c.Param("video_id")},
+			"$set":  bson.M{"updated_at": time.Now()},
+		},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error removing video from playlist"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Video is not in the playlist"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Video removed from playlist"})
+}
+
+type PlaylistOrderRequest struct {
+	Username string   `json:"username"`
+	VideoIds []string `json:"video_ids"`
+}
+
+// Puts the videos of a playlist in a new order, the list must contain exactly the current videos
+func ReorderPlaylist(c *gin.Context) {
+	var request PlaylistOrderRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request"})
+		return
+	}
+
+	playlist, _, ok := authorizePlaylistChange(c, c.Param("playlist_id"), request.Username)
+	if !ok {
+		return
+	}
+
+	current := make(map[string]bool)
+	for _, videoID := range playlist.VideoIds {
+		current[videoID] = true
+	}
+	for _, videoID := range request.VideoIds {
+		if !current[videoID] {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "video_ids must contain every video of the playlist exactly once"})
+			return
+		}
+		delete(current, videoID)
+	}
+	if len(current) > 0 || len(request.VideoIds) != len(playlist.VideoIds) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "video_ids must contain every video of the playlist exactly once"})
+		return
+	}
+
+	// The order was checked against the videos loaded above, videos added or removed since then fail the update
+	updatePlaylist(c,
+		bson.M{"_id": playlist.ID, "video_ids": append([]string{}, playlist.VideoIds...)},
+		bson.M{"video_ids": request.VideoIds},
+	)
+}
+
+// Streams the video that follows after the given one, or the first video without after.
+// The id of the streamed video is sent in X-Playlist-Video-Id so the player can ask for the next one.
+func StreamNextPlaylistVideo(c *gin.Context) {
+	playlist, viewer, ok := viewablePlaylist(c)
+	if !ok {
+		return
+	}
+
+	videos, err := playlistVideos(c, playlist, viewer)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving playlist videos"})
+		return
+	}
+
+	next := 0
+	if after := c.Query("after"); after != "" {
+		next = -1
+		for index, video := range videos {
+			if video.VideoID == after {
+				next = index + 1
+				break
+			}
+		}
+		if next < 0 {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Video is not in the playlist"})
+			return
+		}
+	}
+
+	if next >= len(videos) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "End of playlist"})
+		return
+	}
+
+	c.Header("X-Playlist-Video-Id", videos[next].VideoID)
+	serveVideoStream(c, videos[next])
+}
+
+// Downloads every video of a playlist the viewer may watch as one ZIP, in playlist order
+func GetPlaylistZip(c *gin.Context) {
+	playlist, viewer, ok := viewablePlaylist(c)
+	if !ok {
+		return
+	}
+
+	storage, err := Storage.Default()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error opening media storage"})
+		return
+	}
+
+	videos, err := playlistVideos(c, playlist, viewer)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving playlist videos"})
+		return
+	}
+
+	writeVideosZip(c, &videoListCursor{videos: videos}, storage, videosZip{
+		Name:          playlist.Name + ".zip",
+		EmptyMessage:  "No videos found in the playlist",
+		StreamMessage: "Error streaming video to ZIP",
+		Kind:          "playlist videos",
+	})
+}
@@ -2,10 +2,13 @@ package Functions
 
 import (
 	"backend/Mongo"
+	"backend/Realtime"
 	"backend/Schemas"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"log"
 	"net/http"
 )
 
@@ -25,13 +28,19 @@ func GetPost(c *gin.Context) {
 		return
 	}
 
-	comments, err := GetAllCommentsForPost(post.ID.Hex())
+	page, limit := getPagination(c, "comments_page", "comments_limit", 20)
+	comments, total, err := GetAllCommentsForPost(post.ID.Hex(), CommentQuery{
+		Sort:  c.DefaultQuery("comments_sort", "oldest"),
+		Page:  page,
+		Limit: limit,
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error decoding comments for post"})
 		return
 	}
 
 	post.Comments = comments
+	post.CommentsTotal = total
 
 	c.JSON(http.StatusOK, post)
 }
@@ -53,13 +62,14 @@ func GetAllPosts(c *gin.Context) {
 			return
 		}
 
-		comments, err := GetAllCommentsForPost(post.ID.Hex())
+		comments, total, err := GetAllCommentsForPost(post.ID.Hex(), CommentQuery{})
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error decoding comments for post"})
 			return
 		}
 
 		post.Comments = comments
+		post.CommentsTotal = total
 		posts = append(posts, post)
 	}
 
@@ -78,12 +88,25 @@ func CreatePost(c *gin.Context) {
 		return
 	}
 
-	_, err := Mongo.GetCollection("studenci_district").InsertOne(c, post)
+	post.AcceptedCommentId = ""
+
+	mentions, err := resolveMentions(c, post.Username, post.Problem)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error resolving mentions"})
+		return
+	}
+	post.Mentions = mentions
+
+	result, err := Mongo.GetCollection("studenci_district").InsertOne(c, post)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating post"})
 		return
 	}
 
+	post.ID = result.InsertedID.(primitive.ObjectID)
+	notifyMentions(c, post.Username, post.Mentions, post.ID.Hex(), "")
+	Realtime.Emit(Realtime.Event{Type: Realtime.EventPost, PostId: post.ID.Hex(), Data: post})
+
 	c.JSON(http.StatusOK, gin.H{"message": "Post added successfully"})
 }
 
@@ -102,5 +125,73 @@ func DeletePost(c *gin.Context) {
 		return
 	}
 
+	if err := closeReports(c, Schemas.ReportPost, postId); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error closing reports"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Post deleted successfully"})
 }
+
+type AcceptAnswerRequest struct {
+	PostId    string `json:"post_id"`
+	CommentId string `json:"comment_id"`
+	Username  string `json:"username"`
+}
+
+func AcceptAnswer(c *gin.Context) {
+	var request AcceptAnswerRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request"})
+		return
+	}
+
+	if request.PostId == "" || request.CommentId == "" || request.Username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "post_id, comment_id and username are required"})
+		return
+	}
+
+	postObjId, _ := primitive.ObjectIDFromHex(request.PostId)
+	commentObjId, _ := primitive.ObjectIDFromHex(request.CommentId)
+
+	var post Schemas.Post
+	err := Mongo.GetCollection("studenci_district").FindOne(c, bson.M{"_id": postObjId}).Decode(&post)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Post not found"})
+		return
+	}
+
+	if post.Username != request.Username {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Only the author of the post can accept an answer"})
+		return
+	}
+
+	var comment Schemas.Comment
+	err = Mongo.GetCollection("melje_district").FindOne(c, bson.M{"_id": commentObjId, "post_id": request.PostId}).Decode(&comment)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Comment not found on this post"})
+		return
+	}
+
+	_, err = Mongo.GetCollection("studenci_district").UpdateOne(c, bson.M{"_id": postObjId}, bson.M{"$set": bson.M{"accepted_comment_id": request.CommentId}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error accepting answer"})
+		return
+	}
+
+	if post.AcceptedCommentId != request.CommentId {
+		err = createNotification(c, Schemas.Notification{
+			Username:  comment.Username,
+			Type:      Schemas.NotificationAnswerAccepted,
+			Actor:     request.Username,
+			Message:   fmt.Sprintf("%s accepted your answer", request.Username),
+			PostId:    request.PostId,
+			CommentId: request.CommentId,
+		})
+		if err != nil {
+			log.Printf("(AcceptAnswer) Error notifying %s: %v", comment.Username, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Answer accepted successfully"})
+}
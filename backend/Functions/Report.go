@@ -0,0 +1,565 @@
+package Functions
+
+import (
+	"backend/Config"
+	"backend/Mongo"
+	"backend/Schemas"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const maxReportCommentLength = 1000
+
+// What the owner is told for decisions on reported content other than videos
+var reportDecisionMessages = map[string]string{
+	Schemas.ModerationWarn: "A moderator warned you about reported content",
+	Schemas.ModerationBan:  "A moderator banned your account over reported content",
+}
+
+// A reported piece of content in the moderator inbox
+type InboxItem struct {
+	Schemas.ReportTarget
+	Threshold float64        `json:"threshold"`
+	Reasons   map[string]int `json:"reasons"`
+}
+
+// Validates a report reason and comment, a missing reason is reported as other
+func checkReportDetails(reason *string, comment *string) error {
+	if *reason == "" {
+		*reason = Schemas.FlagOther
+	}
+
+	knownReason := false
+	for _, known := range Schemas.ReportReasons {
+		knownReason = knownReason || known == *reason
+	}
+	if !knownReason {
+		return errors.New("Unknown reason: " + *reason)
+	}
+
+	*comment = strings.TrimSpace(*comment)
+	if utf8.RuneCountInString(*comment) > maxReportCommentLength {
+		return fmt.Errorf("comment must be at most %d characters", maxReportCommentLength)
+	}
+	return nil
+}
+
+func isReportTargetType(targetType string) bool {
+	for _, known := range Schemas.ReportTargetTypes {
+		if known == targetType {
+			return true
+		}
+	}
+	return false
+}
+
+// Report score at which a target is escalated in the inbox, set per type with REPORT_THRESHOLD_POST and
+// so on. Videos use the flag threshold, at which they are also hidden.
+func reportThreshold(targetType string) float64 {
+	if targetType == Schemas.ReportVideo {
+		return flagHideThreshold()
+	}
+	return float64(Config.GetENVInt("REPORT_THRESHOLD_"+strings.ToUpper(targetType), 3))
+}
+
+func reportTargetID(targetType string, targetID string) string {
+	return targetType + ":" + targetID
+}
+
+// Finds who is responsible for the reported content, mongo.ErrNoDocuments when it does not exist
+func reportTargetOwner(ctx context.Context, targetType string, targetID string) (string, error) {
+	if targetType == Schemas.ReportUser {
+		user, err := getUserByUsername(ctx, targetID)
+		return user.Name, err
+	}
+	if targetType == Schemas.ReportVideo {
+		var video Schemas.Video
+		err := Mongo.GetCollection("videostore").FindOne(ctx, bson.M{"video_id": targetID}).Decode(&video)
+		return video.Uploader, err
+	}
+
+	objId, err := primitive.ObjectIDFromHex(targetID)
+	if err != nil {
+		return "", mongo.ErrNoDocuments
+	}
+
+	var content struct {
+		Username string `bson:"username"`
+	}
+	collections := map[string]string{
+		Schemas.ReportPost:         "studenci_district",
+		Schemas.ReportComment:      "melje_district",
+		Schemas.ReportVideoComment: "videostore_comments",
+	}
+	err = Mongo.GetCollection(collections[targetType]).FindOne(ctx, bson.M{"_id": objId}).Decode(&content)
+	return content.Username, err
+}
+
+// Adds a report to the inbox entry of its target, opening the entry if needed
+func trackReport(ctx context.Context, targetType string, targetID string, owner string, weight float64) error {
+	_, err := Mongo.GetCollection("report_targets").UpdateOne(ctx,
+		bson.M{"_id": reportTargetID(targetType, targetID)},
+		bson.A{
+			bson.M{"$set": bson.M{
+				"target_type": targetType,
+				"target_id":   targetID,
+				"owner":       owner,
+				"open":        true,
+				"updated_at":  time.Now(),
+				"reports":     bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$reports", 0}}, 1}},
+				"score":       bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$score", 0}}, weight}},
+			}},
+			bson.M{"$set": bson.M{"escalated": bson.M{"$gte": bson.A{"$score", reportThreshold(targetType)}}}},
+		},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// Takes a retracted report off the inbox entry, which closes once no reports are left
+func untrackReport(ctx context.Context, targetType string, targetID string, weight float64) error {
+	_, err := Mongo.GetCollection("report_targets").UpdateOne(ctx,
+		bson.M{"_id": reportTargetID(targetType, targetID)},
+		bson.A{
+			bson.M{"$set": bson.M{
+				"updated_at": time.Now(),
+				"reports":    bson.M{"$max": bson.A{0, bson.M{"$subtract": bson.A{"$reports", 1}}}},
+				"score":      bson.M{"$max": bson.A{0, bson.M{"$subtract": bson.A{"$score", weight}}}},
+			}},
+			bson.M{"$set": bson.M{
+				"escalated": bson.M{"$gte": bson.A{"$score", reportThreshold(targetType)}},
+				"open":      bson.M{"$gt": bson.A{"$reports", 0}},
+			}},
+		},
+	)
+	return err
+}
+
+// Takes targets out of the inbox once they were decided on or deleted, their reports stop counting
+func closeReports(ctx context.Context, targetType string, targetIDs ...string) error {
+	inboxIDs := make([]string, 0, len(targetIDs))
+	for _, targetID := range targetIDs {
+		inboxIDs = append(inboxIDs, reportTargetID(targetType, targetID))
+	}
+
+	_, err := Mongo.GetCollection("report_targets").UpdateMany(ctx,
+		bson.M{"_id": bson.M{"$in": inboxIDs}},
+		bson.M{"$set": bson.M{"open": false, "reports": 0, "score": 0, "escalated": false, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = Mongo.GetCollection("reports").UpdateMany(ctx,
+		bson.M{"target_type": targetType, "target_id": bson.M{"$in": targetIDs}},
+		bson.M{"$set": bson.M{"cleared": true}},
+	)
+	return err
+}
+
+// Counts the reports that still count per inbox entry and reason, video flags are counted separately
+func reportReasonCounts(ctx context.Context, targets []Schemas.ReportTarget) (map[string]map[string]int, error) {
+	counts := make(map[string]map[string]int)
+
+	var videoIDs []string
+	var others bson.A
+	for _, target := range targets {
+		if target.TargetType == Schemas.ReportVideo {
+			videoIDs = append(videoIDs, target.TargetId)
+		} else {
+			others = append(others, bson.M{"target_type": target.TargetType, "target_id": target.TargetId})
+		}
+	}
+
+	videoCounts, err := flagReasonCounts(ctx, videoIDs)
+	if err != nil {
+		return nil, err
+	}
+	for videoID, reasons := range videoCounts {
+		counts[reportTargetID(Schemas.ReportVideo, videoID)] = reasons
+	}
+
+	if len(others) == 0 {
+		return counts, nil
+	}
+
+	cursor, err := Mongo.GetCollection("reports").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"$or": others, "cleared": false}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"target_type": "$target_type", "target_id": "$target_id", "reason": "$reason"},
+			"count": bson.M{"$sum": 1},
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var result struct {
+			ID struct {
+				TargetType string `bson:"target_type"`
+				TargetId   string `bson:"target_id"`
+				Reason     string `bson:"reason"`
+			} `bson:"_id"`
+			Count int `bson:"count"`
+		}
+		if err := cursor.Decode(&result); err != nil {
+			return nil, err
+		}
+		id := reportTargetID(result.ID.TargetType, result.ID.TargetId)
+		if counts[id] == nil {
+			counts[id] = make(map[string]int)
+		}
+		counts[id][result.ID.Reason] = result.Count
+	}
+
+	return counts, cursor.Err()
+}
+
+type ReportRequest struct {
+	TargetType string `json:"target_type"`
+	TargetID   string `json:"target_id"`
+	UserID     string `json:"user_id"`
+	Reason     string `json:"reason"`
+	Comment    string `json:"comment"`
+}
+
+// Reports a post, comment, video comment, user or video. Every user can report a target once.
+func CreateReport(c *gin.Context) {
+	var request ReportRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request"})
+		return
+	}
+
+	if request.TargetType == "" || request.TargetID == "" || request.UserID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "target_type, target_id and user_id are required"})
+		return
+	}
+	if !isReportTargetType(request.TargetType) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Unknown target_type: " + request.TargetType, "target_types": Schemas.ReportTargetTypes})
+		return
+	}
+
+	if request.TargetType == Schemas.ReportVideo {
+		flagVideo(c, VideoFlagRequest{VideoID: request.TargetID, UserID: request.UserID, Reason: request.Reason, Comment: request.Comment})
+		return
+	}
+
+	if err := checkReportDetails(&request.Reason, &request.Comment); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error(), "reasons": Schemas.ReportReasons})
+		return
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(request.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid user_id format"})
+		return
+	}
+
+	var user Schemas.User
+	err = Mongo.GetCollection("users").FindOne(c, bson.M{"_id": userObjectID}).Decode(&user)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Invalid user"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error verifying user"})
+		return
+	}
+
+	owner, err := reportTargetOwner(c, request.TargetType, request.TargetID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Reported content not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving reported content"})
+		return
+	}
+	if owner == user.Name {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "You can not report yourself"})
+		return
+	}
+
+	report := Schemas.Report{
+		ID:         reportTargetID(request.TargetType, request.TargetID) + ":" + request.UserID,
+		TargetType: request.TargetType,
+		TargetId:   request.TargetID,
+		UserID:     request.UserID,
+		Username:   user.Name,
+		Reason:     request.Reason,
+		Comment:    request.Comment,
+		Weight:     flagWeight(user),
+		CreatedAt:  time.Now(),
+	}
+
+	// The report id is unique per reporter and target, so a second report fails to insert
+	_, err = Mongo.GetCollection("reports").InsertOne(c, report)
+	if mongo.IsDuplicateKeyError(err) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "You have already reported this"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating report"})
+		return
+	}
+
+	if err := trackReport(c, report.TargetType, report.TargetId, owner, report.Weight); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating moderator inbox"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Report submitted successfully", "report": report})
+}
+
+// Withdraws the caller's report on a target
+func RetractReport(c *gin.Context) {
+	targetType := c.Query("target_type")
+	targetID := c.Query("target_id")
+	userID := c.Query("user_id")
+	if targetType == "" || targetID == "" || userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "target_type, target_id and user_id are required"})
+		return
+	}
+
+	if targetType == Schemas.ReportVideo {
+		retractVideoFlag(c, targetID, userID)
+		return
+	}
+
+	var report Schemas.Report
+	err := Mongo.GetCollection("reports").FindOneAndDelete(c, bson.M{"_id": reportTargetID(targetType, targetID) + ":" + userID}).Decode(&report)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "You have not reported this"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retracting report"})
+		return
+	}
+
+	// Reports a moderator already decided on are no longer in the inbox
+	if !report.Cleared {
+		if err := untrackReport(c, targetType, targetID, report.Weight); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating moderator inbox"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Report retracted successfully"})
+}
+
+// Lists everything waiting for a moderator: reported content of every type, escalated targets and
+// the highest scores first, together with the open appeals the moderator may decide
+func GetModerationInbox(c *gin.Context) {
+	moderator, ok := moderatorUser(c, c.Query("admin_username"))
+	if !ok {
+		return
+	}
+
+	filter := bson.M{"open": true}
+	if targetType := c.Query("target_type"); targetType != "" {
+		if !isReportTargetType(targetType) {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Unknown target_type: " + targetType, "target_types": Schemas.ReportTargetTypes})
+			return
+		}
+		filter["target_type"] = targetType
+	}
+	if c.Query("escalated") == "true" {
+		filter["escalated"] = true
+	}
+
+	collection := Mongo.GetCollection("report_targets")
+	total, err := collection.CountDocuments(c, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error counting reports"})
+		return
+	}
+
+	page, limit := getPagination(c, "page", "limit", 20)
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "escalated", Value: -1}, {Key: "score", Value: -1}, {Key: "updated_at", Value: 1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit))
+
+	cursor, err := collection.Find(c, filter, findOptions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving reports"})
+		return
+	}
+	defer cursor.Close(c)
+
+	targets := make([]Schemas.ReportTarget, 0)
+	if err := cursor.All(c, &targets); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error decoding reports"})
+		return
+	}
+
+	reasons, err := reportReasonCounts(c, targets)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error counting report reasons"})
+		return
+	}
+
+	items := make([]InboxItem, 0, len(targets))
+	for _, target := range targets {
+		item := InboxItem{ReportTarget: target, Threshold: reportThreshold(target.TargetType), Reasons: reasons[target.ID]}
+		if item.Reasons == nil {
+			item.Reasons = map[string]int{}
+		}
+		items = append(items, item)
+	}
+
+	appeals, err := openAppeals(c, moderator, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving appeals"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items":   items,
+		"appeals": appeals,
+		"total":   total,
+		"page":    page,
+		"limit":   limit,
+	})
+}
+
+type ReportDecisionRequest struct {
+	AdminUsername string `json:"admin_username"`
+	TargetType    string `json:"target_type"`
+	TargetID      string `json:"target_id"`
+	Action        string `json:"action"`
+	Reason        string `json:"reason"`
+}
+
+// Decides on reported content. Videos take the moderation decisions, other content can be restored,
+// which dismisses the reports, or its owner warned or banned. Reported posts and comments are
+// removed with their delete endpoints, which also close the reports.
+func DecideReport(c *gin.Context) {
+	var request ReportDecisionRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request"})
+		return
+	}
+
+	request.Reason = strings.TrimSpace(request.Reason)
+	if request.TargetType == "" || request.TargetID == "" || request.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "target_type, target_id and reason are required"})
+		return
+	}
+	if !isReportTargetType(request.TargetType) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Unknown target_type: " + request.TargetType, "target_types": Schemas.ReportTargetTypes})
+		return
+	}
+	if utf8.RuneCountInString(request.Reason) > maxModerationReasonLength {
+		c.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("reason must be at most %d characters", maxModerationReasonLength)})
+		return
+	}
+
+	if request.TargetType == Schemas.ReportVideo {
+		decideVideo(c, ModerationDecisionRequest{
+			AdminUsername: request.AdminUsername,
+			VideoID:       request.TargetID,
+			Action:        request.Action,
+			Reason:        request.Reason,
+		})
+		return
+	}
+
+	if request.Action != Schemas.ModerationRestore && request.Action != Schemas.ModerationWarn && request.Action != Schemas.ModerationBan {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "action must be restore, warn or ban"})
+		return
+	}
+
+	moderator, ok := moderatorUser(c, request.AdminUsername)
+	if !ok {
+		return
+	}
+
+	var target Schemas.ReportTarget
+	err := Mongo.GetCollection("report_targets").FindOne(c, bson.M{"_id": reportTargetID(request.TargetType, request.TargetID)}).Decode(&target)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "No reports found for this content"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving reports"})
+		return
+	}
+
+	reasons, err := reportReasonCounts(c, []Schemas.ReportTarget{target})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error counting report reasons"})
+		return
+	}
+
+	decision := Schemas.ModerationDecision{
+		ID:          primitive.NewObjectID(),
+		TargetType:  target.TargetType,
+		TargetId:    target.TargetId,
+		Uploader:    target.Owner,
+		Moderator:   moderator.Name,
+		Action:      request.Action,
+		Reason:      request.Reason,
+		FlagScore:   target.Score,
+		FlagReasons: reasons[target.ID],
+		CreatedAt:   time.Now(),
+	}
+
+	// The decision is recorded before it is applied, so nothing changes without an audit entry.
+	// Reports are closed last and stay in the inbox when applying the decision fails.
+	_, err = Mongo.GetCollection("moderation_log").InsertOne(c, decision)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error recording decision", "error": err.Error()})
+		return
+	}
+
+	var userUpdate bson.M
+	switch request.Action {
+	case Schemas.ModerationWarn:
+		userUpdate = bson.M{"$inc": bson.M{"warnings": 1}}
+	case Schemas.ModerationBan:
+		userUpdate = bson.M{"$set": bson.M{"banned": true}}
+	}
+	if userUpdate != nil {
+		_, err = Mongo.GetCollection("users").UpdateOne(c, bson.M{"username": target.Owner}, userUpdate)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating user", "error": err.Error()})
+			return
+		}
+	}
+
+	if err := closeReports(c, target.TargetType, target.TargetId); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error closing reports"})
+		return
+	}
+
+	// Dismissed reports are not worth bothering the owner about
+	if message, found := reportDecisionMessages[request.Action]; found {
+		err = createNotification(c, Schemas.Notification{
+			Username: target.Owner,
+			Type:     Schemas.NotificationModeration,
+			Actor:    moderator.Name,
+			Message:  fmt.Sprintf("%s (%s)", message, request.Reason),
+		})
+		if err != nil {
+			fmt.Printf("Error notifying %s: %v\n", target.Owner, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Decision recorded", "decision": decision})
+}
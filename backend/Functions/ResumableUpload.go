@@ -0,0 +1,506 @@
+package Functions
+
+import (
+	"backend/Config"
+	"backend/Media"
+	"backend/Mongo"
+	"backend/Schemas"
+	"backend/Storage"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Resumable uploads follow the tus 1.0.0 protocol (https://tus.io/protocols/resumable-upload)
+// with the creation, expiration and termination extensions.
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,expiration,termination"
+
+	// Staged pieces stay well below the 16MB BSON document limit
+	uploadChunkSize = 4 * 1024 * 1024
+)
+
+func uploadExpiration() time.Duration {
+	return time.Duration(Config.GetENVInt("UPLOAD_EXPIRATION_HOURS", 24)) * time.Hour
+}
+
+func setTusHeaders(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Cache-Control", "no-store")
+}
+
+// Rejects requests made with a protocol version this server does not speak
+func checkTusVersion(c *gin.Context) bool {
+	if c.GetHeader("Tus-Resumable") != tusVersion {
+		c.Header("Tus-Version", tusVersion)
+		c.JSON(http.StatusPreconditionFailed, gin.H{"message": "Unsupported Tus-Resumable version"})
+		return false
+	}
+	return true
+}
+
+// Parses the Upload-Metadata header, a comma separated list of keys with base64 encoded values
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		parts := strings.Fields(pair)
+		if len(parts) == 0 || len(parts) > 2 {
+			return nil, fmt.Errorf("invalid metadata pair %q", pair)
+		}
+
+		value := ""
+		if len(parts) == 2 {
+			decoded, err := base64.StdEncoding.DecodeString(parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid base64 value for %q", parts[0])
+			}
+			value = string(decoded)
+		}
+		metadata[parts[0]] = value
+	}
+
+	return metadata, nil
+}
+
+func findUpload(c *gin.Context) (Schemas.Upload, bool) {
+	var upload Schemas.Upload
+
+	uploadID, err := primitive.ObjectIDFromHex(c.Param("upload_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Upload not found"})
+		return upload, false
+	}
+
+	err = Mongo.GetCollection("videostore_uploads").FindOne(c, bson.M{"_id": uploadID, "expires_at": bson.M{"$gt": time.Now()}}).Decode(&upload)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Upload not found"})
+			return upload, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving upload"})
+		return upload, false
+	}
+
+	return upload, true
+}
+
+// Advertises the supported protocol version, extensions and maximum size
+func GetUploadOptions(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	c.Header("Tus-Max-Size", strconv.FormatInt(maxVideoSizeAnyRole(), 10))
+	c.Status(http.StatusNoContent)
+}
+
+func CreateUpload(c *gin.Context) {
+	if !checkTusVersion(c) {
+		return
+	}
+	setTusHeaders(c)
+
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "A positive Upload-Length is required"})
+		return
+	}
+
+	metadata, err := parseUploadMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid Upload-Metadata", "error": err.Error()})
+		return
+	}
+
+	metadata["title"] = strings.TrimSpace(metadata["title"])
+	if err := validateVideoDetails(metadata["title"], metadata["description"], normalizeTags([]string{metadata["flags"]})); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error() + " in Upload-Metadata"})
+		return
+	}
+	if _, err := parseVideoAccess(metadata["visibility"], metadata["course_group"], metadata["publish_at"]); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error() + " in Upload-Metadata"})
+		return
+	}
+
+	sizeLimit, err := uploadLimitFor(c, metadata["uploader_username"])
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Uploader not found"})
+			return
+		}
+		if errors.Is(err, errUploaderBanned) {
+			c.JSON(http.StatusForbidden, gin.H{"message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving user data"})
+		return
+	}
+
+	if length > sizeLimit {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"message": "Upload exceeds the maximum size", "max_size": sizeLimit})
+		return
+	}
+
+	now := time.Now()
+	upload := Schemas.Upload{
+		ID:        primitive.NewObjectID(),
+		Length:    length,
+		Offset:    0,
+		Metadata:  metadata,
+		CreatedAt: now,
+		ExpiresAt: now.Add(uploadExpiration()),
+	}
+
+	_, err = Mongo.GetCollection("videostore_uploads").InsertOne(c, upload)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating upload"})
+		return
+	}
+
+	c.Header("Location", "/videostore/uploads/"+upload.ID.Hex())
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.Status(http.StatusCreated)
+}
+
+// Reports how many bytes of an upload the server has received
+func GetUploadOffset(c *gin.Context) {
+	if !checkTusVersion(c) {
+		return
+	}
+	setTusHeaders(c)
+
+	upload, ok := findUpload(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.Status(http.StatusOK)
+}
+
+// Appends the request body to an upload at the offset the client claims to resume from
+func PatchUpload(c *gin.Context) {
+	if !checkTusVersion(c) {
+		return
+	}
+	setTusHeaders(c)
+
+	if c.ContentType() != "application/offset+octet-stream" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"message": "Content-Type must be application/offset+octet-stream"})
+		return
+	}
+
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "A valid Upload-Offset is required"})
+		return
+	}
+
+	upload, ok := findUpload(c)
+	if !ok {
+		return
+	}
+
+	if upload.VideoID != "" || upload.Finalizing || offset != upload.Offset {
+		c.JSON(http.StatusConflict, gin.H{"message": "Upload-Offset does not match the current offset"})
+		return
+	}
+
+	uploads := Mongo.GetCollection("videostore_uploads")
+	chunks := Mongo.GetCollection("videostore_upload_chunks")
+
+	// Every piece is committed on its own, so an interrupted request keeps the bytes received so far
+	body := io.LimitReader(c.Request.Body, upload.Length-offset)
+	buffer := make([]byte, uploadChunkSize)
+	for {
+		n, readErr := io.ReadFull(body, buffer)
+		if n > 0 {
+			chunk := Schemas.UploadChunk{UploadID: upload.ID, Offset: offset, Data: buffer[:n]}
+			inserted, err := chunks.InsertOne(c, chunk)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"message": "Error storing upload chunk"})
+				return
+			}
+
+			// Guarding on the old offset keeps concurrent requests from interleaving their bytes.
+			// Progress also pushes the expiration back so a slow upload is not cleaned up mid-transfer.
+			expiresAt := time.Now().Add(uploadExpiration())
+			result, err := uploads.UpdateOne(c,
+				bson.M{"_id": upload.ID, "offset": offset},
+				bson.M{"$set": bson.M{"offset": offset + int64(n), "expires_at": expiresAt}},
+			)
+			if err != nil || result.MatchedCount == 0 {
+				// Only this request's chunk is removed, the winner may have stored one at the same offset
+				if _, deleteErr := chunks.DeleteOne(c, bson.M{"_id": inserted.InsertedID}); deleteErr != nil {
+					log.Printf("(PatchUpload) Error removing chunk of upload %s at offset %d: %v", upload.ID.Hex(), offset, deleteErr)
+				}
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating upload offset"})
+					return
+				}
+				c.JSON(http.StatusConflict, gin.H{"message": "Upload was modified concurrently"})
+				return
+			}
+			offset += int64(n)
+			upload.ExpiresAt = expiresAt
+		}
+
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			// The client went away, the offset already reflects what was stored
+			log.Printf("(PatchUpload) Error reading upload %s: %v", upload.ID.Hex(), readErr)
+			return
+		}
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(offset, 10))
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+
+	if offset == upload.Length {
+		// Only one request may finalize, a retried or concurrent final PATCH would create the video twice
+		result, err := uploads.UpdateOne(c,
+			bson.M{"_id": upload.ID, "offset": upload.Length, "finalizing": bson.M{"$ne": true}, "video_id": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"finalizing": true}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error finalizing upload"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusConflict, gin.H{"message": "Upload is already being finalized"})
+			return
+		}
+
+		upload.Offset = offset
+		videoMetadata, err := finalizeUpload(c, upload)
+		if errors.Is(err, errUnsupportedVideo) || errors.Is(err, errDisguisedVideo) || errors.Is(err, Media.ErrInvalidMP4) {
+			// The bytes can never become a valid video, so the upload is discarded
+			if err := removeUpload(c, upload.ID); err != nil {
+				log.Printf("(PatchUpload) Error removing rejected upload %s: %v", upload.ID.Hex(), err)
+			}
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"message": err.Error()})
+			return
+		}
+		if errors.Is(err, errUploaderBanned) {
+			if err := removeUpload(c, upload.ID); err != nil {
+				log.Printf("(PatchUpload) Error removing upload %s of a banned uploader: %v", upload.ID.Hex(), err)
+			}
+			c.JSON(http.StatusForbidden, gin.H{"message": err.Error()})
+			return
+		}
+		if err != nil {
+			// Released so the client can retry the final request
+			if _, releaseErr := uploads.UpdateOne(context.Background(), bson.M{"_id": upload.ID, "video_id": bson.M{"$exists": false}}, bson.M{"$unset": bson.M{"finalizing": ""}}); releaseErr != nil {
+				log.Printf("(PatchUpload) Error releasing upload %s: %v", upload.ID.Hex(), releaseErr)
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error finalizing upload", "error": err.Error()})
+			return
+		}
+		c.Header("Upload-Video-Id", videoMetadata.VideoID)
+		c.Header("Upload-Video-Sha256", videoMetadata.SHA256)
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Copies the staged chunks of a completed upload into the media storage and creates the video metadata
+func finalizeUpload(ctx context.Context, upload Schemas.Upload) (Schemas.Video, error) {
+	// The uploader may have been banned or removed since the upload was created
+	if _, err := uploadLimitFor(ctx, upload.Metadata["uploader_username"]); err != nil {
+		return Schemas.Video{}, err
+	}
+
+	title := upload.Metadata["title"]
+	uniqueFilename, err := uniqueVideoFilename(title)
+	if err != nil {
+		return Schemas.Video{}, err
+	}
+
+	storage, err := Storage.Default()
+	if err != nil {
+		return Schemas.Video{}, err
+	}
+
+	chunks := Mongo.GetCollection("videostore_upload_chunks")
+	cursor, err := chunks.Find(ctx, bson.M{"upload_id": upload.ID}, options.Find().SetSort(bson.M{"offset": 1}))
+	if err != nil {
+		return Schemas.Video{}, err
+	}
+	defer cursor.Close(ctx)
+
+	// Verify the container the same way as a regular upload before anything is stored
+	container, videoStream, err := sniffVideo(&uploadChunkReader{ctx: ctx, cursor: cursor}, upload.Metadata["filename"])
+	if err != nil {
+		return Schemas.Video{}, err
+	}
+
+	access, err := parseVideoAccess(upload.Metadata["visibility"], upload.Metadata["course_group"], upload.Metadata["publish_at"])
+	if err != nil {
+		return Schemas.Video{}, err
+	}
+
+	blob, err := storeVideoBlob(ctx, storage, uniqueFilename, videoStream)
+	if err != nil {
+		return Schemas.Video{}, err
+	}
+
+	media, err := probeVideo(ctx, storage, container, blob)
+	if err != nil {
+		releaseVideoBlob(ctx, storage, Schemas.Video{BlobID: blob.BlobID, SHA256: blob.SHA256})
+		return Schemas.Video{}, err
+	}
+
+	videoMetadata, err := saveVideoMetadata(Schemas.Video{
+		VideoName:   title,
+		Uploader:    upload.Metadata["uploader_username"],
+		Description: upload.Metadata["description"],
+		Tags:        normalizeTags([]string{upload.Metadata["flags"]}),
+		VideoID:     Storage.NewID(),
+		BlobID:      blob.BlobID,
+		SHA256:      blob.SHA256,
+		ContentType: container.ContentType,
+		Filename:    upload.Metadata["filename"],
+		Size:        blob.Size,
+		Media:       media,
+		Visibility:  access.Visibility,
+		CourseGroup: access.CourseGroup,
+		PublishAt:   access.PublishAt,
+	})
+	if err != nil {
+		releaseVideoBlob(ctx, storage, Schemas.Video{BlobID: blob.BlobID, SHA256: blob.SHA256})
+		return Schemas.Video{}, err
+	}
+
+	// The upload document stays until it expires so HEAD keeps reporting the final offset
+	_, err = Mongo.GetCollection("videostore_uploads").UpdateOne(ctx, bson.M{"_id": upload.ID}, bson.M{
+		"$set":   bson.M{"video_id": videoMetadata.VideoID},
+		"$unset": bson.M{"finalizing": ""},
+	})
+	if err != nil {
+		return videoMetadata, err
+	}
+
+	_, err = chunks.DeleteMany(ctx, bson.M{"upload_id": upload.ID})
+	return videoMetadata, err
+}
+
+// Reads the staged chunks of an upload in order as one continuous stream
+type uploadChunkReader struct {
+	ctx    context.Context
+	cursor *mongo.Cursor
+	buffer []byte
+}
+
+func (r *uploadChunkReader) Read(p []byte) (int, error) {
+	for len(r.buffer) == 0 {
+		if !r.cursor.Next(r.ctx) {
+			if err := r.cursor.Err(); err != nil {
+				return 0, err
+			}
+			return 0, io.EOF
+		}
+
+		var chunk Schemas.UploadChunk
+		if err := r.cursor.Decode(&chunk); err != nil {
+			return 0, err
+		}
+		r.buffer = chunk.Data
+	}
+
+	n := copy(p, r.buffer)
+	r.buffer = r.buffer[n:]
+	return n, nil
+}
+
+// Cancels an upload and discards the bytes staged for it
+func DeleteUpload(c *gin.Context) {
+	if !checkTusVersion(c) {
+		return
+	}
+	setTusHeaders(c)
+
+	upload, ok := findUpload(c)
+	if !ok {
+		return
+	}
+
+	if err := removeUpload(c, upload.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error deleting upload"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func removeUpload(ctx context.Context, uploadID primitive.ObjectID) error {
+	_, err := Mongo.GetCollection("videostore_upload_chunks").DeleteMany(ctx, bson.M{"upload_id": uploadID})
+	if err != nil {
+		return err
+	}
+
+	_, err = Mongo.GetCollection("videostore_uploads").DeleteOne(ctx, bson.M{"_id": uploadID})
+	return err
+}
+
+// Periodically removes uploads that expired before being completed or cleaned up
+func StartUploadCleanup() {
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+
+		for {
+			cleanupExpiredUploads()
+			<-ticker.C
+		}
+	}()
+}
+
+func cleanupExpiredUploads() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	cursor, err := Mongo.GetCollection("videostore_uploads").Find(ctx, bson.M{"expires_at": bson.M{"$lte": time.Now()}})
+	if err != nil {
+		log.Printf("(cleanupExpiredUploads) Error querying expired uploads: %v", err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	removed := 0
+	for cursor.Next(ctx) {
+		var upload Schemas.Upload
+		if err := cursor.Decode(&upload); err != nil {
+			continue
+		}
+		if err := removeUpload(ctx, upload.ID); err != nil {
+			log.Printf("(cleanupExpiredUploads) Error removing upload %s: %v", upload.ID.Hex(), err)
+			continue
+		}
+		removed++
+	}
+
+	if removed > 0 {
+		log.Printf("(cleanupExpiredUploads) Removed %d expired uploads", removed)
+	}
+}
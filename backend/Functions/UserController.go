@@ -3,12 +3,21 @@ package Functions
 import (
 	"backend/Mongo"
 	"backend/Schemas"
+	"context"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 	"golang.org/x/crypto/bcrypt"
 	"net/http"
 )
 
+func getUserByUsername(ctx context.Context, username string) (Schemas.User, error) {
+	var user Schemas.User
+	err := Mongo.GetCollection("users").FindOne(ctx, bson.M{"username": username}).Decode(&user)
+	return user, err
+}
+
 func GetProfile(c *gin.Context) {
 	username := c.Query("username")
 	if username == "" {
@@ -55,6 +64,11 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	if user.Banned {
+		c.JSON(http.StatusForbidden, gin.H{"message": "This account has been banned"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Login successful",
 		"user":    user.Name,
@@ -75,6 +89,13 @@ func Register(c *gin.Context) {
 		return
 	}
 	user.Password = string(hashedPassword)
+	user.Admin = false
+	user.Blocked = []string{}
+	user.NotificationPreferences = map[string]bool{}
+	user.CourseGroups = []string{}
+	user.FlagReputation = nil
+	user.Warnings = 0
+	user.Banned = false
 
 	client := Mongo.GetMongoDB()
 	_, err = client.Database("Pametni-Paketnik-baza").Collection("users").InsertOne(c, user)
@@ -119,3 +140,175 @@ func ChangePassword(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully"})
 }
+
+type BlockRequest struct {
+	Username        string `json:"username"`
+	BlockedUsername string `json:"blocked_username"`
+}
+
+func BlockUser(c *gin.Context) {
+	var request BlockRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request"})
+		return
+	}
+
+	if request.Username == "" || request.BlockedUsername == "" || request.Username == request.BlockedUsername {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "username and a different blocked_username are required"})
+		return
+	}
+
+	client := Mongo.GetMongoDB()
+	count, err := client.Database("Pametni-Paketnik-baza").Collection("users").CountDocuments(c, bson.M{"username": request.BlockedUsername})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving user"})
+		return
+	}
+	if count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"message": "User to block not found"})
+		return
+	}
+
+	result, err := client.Database("Pametni-Paketnik-baza").Collection("users").UpdateOne(c, bson.M{"username": request.Username}, bson.M{"$addToSet": bson.M{"blocked": request.BlockedUsername}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error blocking user"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"message": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User blocked successfully"})
+}
+
+func UnblockUser(c *gin.Context) {
+	var request BlockRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request"})
+		return
+	}
+
+	if request.Username == "" || request.BlockedUsername == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "username and blocked_username are required"})
+		return
+	}
+
+	client := Mongo.GetMongoDB()
+	result, err := client.Database("Pametni-Paketnik-baza").Collection("users").UpdateOne(c, bson.M{"username": request.Username}, bson.M{"$pull": bson.M{"blocked": request.BlockedUsername}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error unblocking user"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"message": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User unblocked successfully"})
+}
+
+type CourseGroupsRequest struct {
+	AdminUsername string   `json:"admin_username"`
+	Username      string   `json:"username"`
+	CourseGroups  []string `json:"course_groups"`
+}
+
+// Replaces the course groups of a user, only moderators can assign them
+func SetCourseGroups(c *gin.Context) {
+	var request CourseGroupsRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request"})
+		return
+	}
+
+	if request.AdminUsername == "" || request.Username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "admin_username and username are required"})
+		return
+	}
+
+	admin, err := getUserByUsername(c, request.AdminUsername)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Admin user not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving user data"})
+		return
+	}
+	if !admin.Admin {
+		c.JSON(http.StatusForbidden, gin.H{"message": "You are not authorized to assign course groups"})
+		return
+	}
+
+	courseGroups := normalizeTags(request.CourseGroups)
+	result, err := Mongo.GetCollection("users").UpdateOne(c, bson.M{"username": request.Username}, bson.M{"$set": bson.M{"course_groups": courseGroups}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating course groups"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"message": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Course groups updated successfully", "course_groups": courseGroups})
+}
+
+// Highest weight a moderator can give a user's flags
+const maxFlagReputation = 5
+
+type FlagReputationRequest struct {
+	AdminUsername  string   `json:"admin_username"`
+	Username       string   `json:"username"`
+	FlagReputation *float64 `json:"flag_reputation"` // null restores the default weight
+}
+
+// Sets how much a user's flags count when FLAG_REPUTATION_WEIGHTING is enabled, zero ignores them
+func SetFlagReputation(c *gin.Context) {
+	var request FlagReputationRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request"})
+		return
+	}
+
+	if request.AdminUsername == "" || request.Username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "admin_username and username are required"})
+		return
+	}
+	if request.FlagReputation != nil && (*request.FlagReputation < 0 || *request.FlagReputation > maxFlagReputation) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("flag_reputation must be between 0 and %d", maxFlagReputation)})
+		return
+	}
+
+	admin, err := getUserByUsername(c, request.AdminUsername)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Admin user not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving user data"})
+		return
+	}
+	if !admin.Admin {
+		c.JSON(http.StatusForbidden, gin.H{"message": "You are not authorized to change flag reputation"})
+		return
+	}
+
+	update := bson.M{"$unset": bson.M{"flag_reputation": ""}}
+	if request.FlagReputation != nil {
+		update = bson.M{"$set": bson.M{"flag_reputation": *request.FlagReputation}}
+	}
+
+	result, err := Mongo.GetCollection("users").UpdateOne(c, bson.M{"username": request.Username}, update)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating flag reputation"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"message": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Flag reputation updated successfully", "flag_reputation": request.FlagReputation})
+}
@@ -0,0 +1,414 @@
+package Functions
+
+import (
+	"backend/Config"
+	"backend/Mongo"
+	"backend/Schemas"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const statsDayFormat = "2006-01-02"
+
+// Time during which repeated views from the same user or session count once
+func viewDedupWindow() time.Duration {
+	return time.Duration(Config.GetENVInt("VIEW_DEDUP_MINUTES", 30)) * time.Minute
+}
+
+// Adds to the counters of a video for the current UTC day
+func incrementDailyStats(ctx context.Context, videoID string, increments bson.M) error {
+	day := time.Now().UTC().Format(statsDayFormat)
+	_, err := Mongo.GetCollection("videostore_daily_stats").UpdateOne(ctx,
+		bson.M{"_id": videoID + ":" + day},
+		bson.M{
+			"$inc":         increments,
+			"$setOnInsert": bson.M{"video_id": videoID, "day": day},
+		},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// Identifies who is watching for deduplication, signed in viewers by username and everyone else
+// by the session id the player generates. When ok is false the error response is already written.
+func watchSessionKey(c *gin.Context, viewer *Schemas.User, sessionID string) (string, bool) {
+	if viewer != nil {
+		return "user:" + viewer.Name, true
+	}
+	if sessionID == "" || len(sessionID) > 128 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "session_id is required for anonymous viewers"})
+		return "", false
+	}
+	return "session:" + sessionID, true
+}
+
+// Loads the video for a playback report, when ok is false the error response is already written
+func playbackVideo(c *gin.Context) (video Schemas.Video, viewer *Schemas.User, ok bool) {
+	viewer, ok = videoViewer(c)
+	if !ok {
+		return
+	}
+
+	video, err := findVisibleVideo(c, viewer, c.Param("video_id"))
+	if err != nil {
+		ok = false
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Video not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving video metadata"})
+		return
+	}
+
+	return video, viewer, true
+}
+
+type ViewRequest struct {
+	SessionID string `json:"session_id"`
+}
+
+// Counts a view, repeated views by the same user or session within the window are ignored
+func RecordVideoView(c *gin.Context) {
+	var request ViewRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request"})
+		return
+	}
+
+	video, viewer, ok := playbackVideo(c)
+	if !ok {
+		return
+	}
+
+	sessionKey, ok := watchSessionKey(c, viewer, request.SessionID)
+	if !ok {
+		return
+	}
+
+	// The upsert only matches when the last counted view is older than the window. A recent
+	// view makes it insert a second document with the same id, which fails as a duplicate.
+	now := time.Now()
+	_, err := Mongo.GetCollection("videostore_view_windows").UpdateOne(c,
+		bson.M{"_id": video.VideoID + ":" + sessionKey, "counted_at": bson.M{"$lt": now.Add(-viewDedupWindow())}},
+		bson.M{"$set": bson.M{"counted_at": now, "expires_at": now.Add(viewDedupWindow())}},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		c.JSON(http.StatusOK, gin.H{"message": "View already counted", "counted": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error recording view"})
+		return
+	}
+
+	_, err = Mongo.GetCollection("videostore").UpdateOne(c, bson.M{"video_id": video.VideoID}, bson.M{"$inc": bson.M{"views": 1}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating view count"})
+		return
+	}
+
+	if err := incrementDailyStats(c, video.VideoID, bson.M{"views": 1}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating video statistics"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "View recorded", "counted": true})
+}
+
+type WatchReport struct {
+	SessionID      string  `json:"session_id"`
+	WatchedSeconds float64 `json:"watched_seconds"` // Total for the session so far
+	Buckets        []int   `json:"buckets"`         // Indexes of the retention buckets the session played
+}
+
+// Adds the watch time and retention buckets the player reports for a session. A session may
+// report repeatedly, only the increase over its previous report is counted.
+func ReportVideoWatch(c *gin.Context) {
+	var report WatchReport
+	if err := c.ShouldBindJSON(&report); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request"})
+		return
+	}
+
+	video, viewer, ok := playbackVideo(c)
+	if !ok {
+		return
+	}
+
+	sessionKey, ok := watchSessionKey(c, viewer, report.SessionID)
+	if !ok {
+		return
+	}
+
+	// A session can not watch more than a day, or more than twice the video with rewinds
+	maxSeconds := float64(24 * 60 * 60)
+	if video.Media != nil && video.Media.Duration > 0 && 2*video.Media.Duration < maxSeconds {
+		maxSeconds = 2 * video.Media.Duration
+	}
+	if report.WatchedSeconds < 0 || report.WatchedSeconds > maxSeconds {
+		c.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("watched_seconds must be between 0 and %.0f", maxSeconds)})
+		return
+	}
+
+	buckets := make([]int, 0, len(report.Buckets))
+	for _, bucket := range report.Buckets {
+		if bucket < 0 || bucket >= Schemas.RetentionBuckets {
+			c.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("buckets must be between 0 and %d", Schemas.RetentionBuckets-1)})
+			return
+		}
+		buckets = append(buckets, bucket)
+	}
+
+	// Merge the report into what the session counted before and learn the previous state in one
+	// step, so concurrent or repeated reports never count the same seconds or buckets twice. A
+	// session that was quiet for longer than the window starts over like a new view.
+	now := time.Now()
+	live := bson.M{"$gt": bson.A{"$expires_at", now}}
+	var previous Schemas.VideoWatchReport
+	err := Mongo.GetCollection("videostore_watch_reports").FindOneAndUpdate(c,
+		bson.M{"_id": video.VideoID + ":" + sessionKey},
+		bson.A{bson.M{"$set": bson.M{
+			"video_id":        video.VideoID,
+			"watched_seconds": bson.M{"$cond": bson.A{live, bson.M{"$max": bson.A{"$watched_seconds", report.WatchedSeconds}}, report.WatchedSeconds}},
+			"buckets":         bson.M{"$cond": bson.A{live, bson.M{"$setUnion": bson.A{bson.M{"$ifNull": bson.A{"$buckets", bson.A{}}}, buckets}}, bson.M{"$setUnion": bson.A{buckets}}}},
+			"expires_at":      now.Add(viewDedupWindow()),
+		}}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before),
+	).Decode(&previous)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error recording watch time"})
+		return
+	}
+	if !previous.ExpiresAt.After(now) {
+		previous = Schemas.VideoWatchReport{}
+	}
+
+	increments := bson.M{}
+	if report.WatchedSeconds > previous.WatchedSeconds {
+		increments["watch_seconds"] = report.WatchedSeconds - previous.WatchedSeconds
+	}
+	counted := make(map[int]bool)
+	for _, bucket := range previous.Buckets {
+		counted[bucket] = true
+	}
+	for _, bucket := range buckets {
+		if !counted[bucket] {
+			counted[bucket] = true
+			increments["retention."+strconv.Itoa(bucket)] = 1
+		}
+	}
+
+	if len(increments) == 0 {
+		c.JSON(http.StatusOK, gin.H{"message": "Watch time already recorded"})
+		return
+	}
+
+	if err := incrementDailyStats(c, video.VideoID, increments); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating video statistics"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Watch time recorded"})
+}
+
+type VoteRequest struct {
+	Username string `json:"username"`
+	Vote     string `json:"vote"` // like, dislike or none to withdraw the vote
+}
+
+// Likes or dislikes a video, every user has a single vote that can be changed or withdrawn
+func VoteVideo(c *gin.Context) {
+	videoID := c.Param("video_id")
+
+	var request VoteRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request"})
+		return
+	}
+
+	value := 0
+	switch request.Vote {
+	case "like":
+		value = 1
+	case "dislike":
+		value = -1
+	case "none":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"message": "vote must be like, dislike or none"})
+		return
+	}
+
+	if request.Username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "username is required"})
+		return
+	}
+
+	user, err := getUserByUsername(c, request.Username)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving user data"})
+		return
+	}
+
+	if _, err := findVisibleVideo(c, &user, videoID); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Video not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving video metadata"})
+		return
+	}
+
+	// Swap in the new vote and learn the previous one in a single step
+	votes := Mongo.GetCollection("videostore_votes")
+	voteID := videoID + ":" + user.Name
+	var previous Schemas.VideoVote
+	if value == 0 {
+		err = votes.FindOneAndDelete(c, bson.M{"_id": voteID}).Decode(&previous)
+	} else {
+		err = votes.FindOneAndUpdate(c,
+			bson.M{"_id": voteID},
+			bson.M{"$set": bson.M{"video_id": videoID, "username": user.Name, "value": value, "updated_at": time.Now()}},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before),
+		).Decode(&previous)
+	}
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving vote"})
+		return
+	}
+
+	increments := bson.M{}
+	if previous.Value == 1 && value != 1 {
+		increments["likes"] = -1
+	}
+	if previous.Value == -1 && value != -1 {
+		increments["dislikes"] = -1
+	}
+	if value == 1 && previous.Value != 1 {
+		increments["likes"] = 1
+	}
+	if value == -1 && previous.Value != -1 {
+		increments["dislikes"] = 1
+	}
+
+	if len(increments) > 0 {
+		_, err = Mongo.GetCollection("videostore").UpdateOne(c, bson.M{"video_id": videoID}, bson.M{"$inc": increments})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating vote counts"})
+			return
+		}
+		if err := incrementDailyStats(c, videoID, increments); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating video statistics"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Vote saved", "vote": request.Vote})
+}
+
+// Returns daily views, votes and watch time of a video together with its retention curve,
+// only the uploader and moderators can see them
+func GetVideoAnalytics(c *gin.Context) {
+	videoID := c.Param("video_id")
+
+	video, _, ok := authorizeVideoChange(c, videoID, c.Query("username"))
+	if !ok {
+		return
+	}
+
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil || days < 1 || days > 365 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "days must be between 1 and 365"})
+		return
+	}
+
+	to := time.Now().UTC()
+	from := to.AddDate(0, 0, -(days - 1))
+
+	cursor, err := Mongo.GetCollection("videostore_daily_stats").Find(c,
+		bson.M{"video_id": videoID, "day": bson.M{"$gte": from.Format(statsDayFormat), "$lte": to.Format(statsDayFormat)}},
+		options.Find().SetSort(bson.M{"day": 1}),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving video statistics"})
+		return
+	}
+	defer cursor.Close(c)
+
+	stored := make([]Schemas.VideoDailyStats, 0)
+	if err := cursor.All(c, &stored); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error decoding video statistics"})
+		return
+	}
+
+	byDay := make(map[string]Schemas.VideoDailyStats)
+	for _, stats := range stored {
+		byDay[stats.Day] = stats
+	}
+
+	// Days without activity are filled in so charts get an evenly spaced series
+	daily := make([]Schemas.VideoDailyStats, 0, days)
+	retention := make([]int64, Schemas.RetentionBuckets)
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		key := day.Format(statsDayFormat)
+		stats, found := byDay[key]
+		if !found {
+			stats = Schemas.VideoDailyStats{VideoId: videoID, Day: key}
+		}
+		for bucket, count := range stats.Retention {
+			if index, err := strconv.Atoi(bucket); err == nil && index >= 0 && index < Schemas.RetentionBuckets {
+				retention[index] += count
+			}
+		}
+		stats.Retention = nil
+		daily = append(daily, stats)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"video_id": videoID,
+		"totals": gin.H{
+			"views":    video.Views,
+			"likes":    video.Likes,
+			"dislikes": video.Dislikes,
+			"comments": video.CommentCount,
+		},
+		"from":      from.Format(statsDayFormat),
+		"to":        to.Format(statsDayFormat),
+		"daily":     daily,
+		"retention": retention,
+	})
+}
+
+// Regularly forgets view windows and watch reports that have run out, they are only needed for deduplication
+func StartViewWindowCleanup() {
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			for _, collection := range []string{"videostore_view_windows", "videostore_watch_reports"} {
+				_, err := Mongo.GetCollection(collection).DeleteMany(ctx, bson.M{"expires_at": bson.M{"$lte": time.Now()}})
+				if err != nil {
+					log.Printf("(StartViewWindowCleanup) Error removing expired documents from %s: %v", collection, err)
+				}
+			}
+			cancel()
+			<-ticker.C
+		}
+	}()
+}
@@ -0,0 +1,96 @@
+package Functions
+
+import (
+	"backend/Mongo"
+	"backend/Schemas"
+	"backend/Storage"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Stores a video file while hashing it. When a file with the same SHA-256 already exists the
+// new copy is dropped and the existing file gains a reference instead.
+func storeVideoBlob(ctx context.Context, storage Storage.Backend, name string, stream io.Reader) (Schemas.VideoBlob, error) {
+	hasher := sha256.New()
+	blobID := Storage.NewID()
+
+	size, err := storage.Put(ctx, blobID, name, io.TeeReader(stream, hasher))
+	if err != nil {
+		return Schemas.VideoBlob{}, err
+	}
+	hash := hex.EncodeToString(hasher.Sum(nil))
+
+	// The hash is the document id, so concurrent identical uploads settle on a single file
+	var blob Schemas.VideoBlob
+	err = Mongo.GetCollection("videostore_blobs").FindOneAndUpdate(ctx,
+		bson.M{"_id": hash},
+		bson.M{
+			"$setOnInsert": bson.M{"blob_id": blobID, "size": size, "created_at": time.Now()},
+			"$inc":         bson.M{"refs": 1},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&blob)
+	if err != nil {
+		storage.Delete(ctx, blobID)
+		return Schemas.VideoBlob{}, err
+	}
+
+	if blob.BlobID != blobID {
+		if err := storage.Delete(ctx, blobID); err != nil {
+			fmt.Printf("Error deleting duplicate blob %s: %v\n", blobID, err)
+		}
+	}
+
+	return blob, nil
+}
+
+// Drops a video's reference to its file, deleting the file once no video uses it anymore
+func releaseVideoBlob(ctx context.Context, storage Storage.Backend, videoMetadata Schemas.Video) error {
+	// Videos uploaded before deduplication own their file outright
+	if videoMetadata.SHA256 == "" {
+		return storage.Delete(ctx, videoBlobID(videoMetadata))
+	}
+
+	blobs := Mongo.GetCollection("videostore_blobs")
+	var blob Schemas.VideoBlob
+	err := blobs.FindOneAndUpdate(ctx,
+		bson.M{"_id": videoMetadata.SHA256},
+		bson.M{"$inc": bson.M{"refs": -1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&blob)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return storage.Delete(ctx, videoBlobID(videoMetadata))
+		}
+		return err
+	}
+
+	if blob.Refs > 0 {
+		return nil
+	}
+
+	// Only delete if no upload picked the file up again in the meantime
+	result, err := blobs.DeleteOne(ctx, bson.M{"_id": blob.SHA256, "refs": bson.M{"$lte": 0}})
+	if err != nil || result.DeletedCount == 0 {
+		return err
+	}
+
+	return storage.Delete(ctx, blob.BlobID)
+}
+
+// Id of the stored file of a video, older videos stored it under their own id
+func videoBlobID(videoMetadata Schemas.Video) string {
+	if videoMetadata.BlobID != "" {
+		return videoMetadata.BlobID
+	}
+	return videoMetadata.VideoID
+}
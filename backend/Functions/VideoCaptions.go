@@ -0,0 +1,236 @@
+package Functions
+
+import (
+	"backend/Media"
+	"backend/Mongo"
+	"backend/Schemas"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Largest caption file that can be uploaded, tracks are kept inside a Mongo document
+const maxCaptionSize = 2 * 1024 * 1024
+
+// Simplified BCP 47 language tag such as sl, en or en-GB
+var languagePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+// Caption track as listed next to a video, with the URL the player loads it from
+type CaptionTrackItem struct {
+	Schemas.CaptionTrack
+	URL string `json:"url"`
+}
+
+func captionURL(videoID string, language string) string {
+	return "/videostore/captions/" + videoID + "/" + language
+}
+
+// Lists the caption tracks of a video the viewer may watch
+func GetCaptionTracks(c *gin.Context) {
+	videoID := c.Param("video_id")
+
+	viewer, ok := videoViewer(c)
+	if !ok {
+		return
+	}
+
+	if _, err := findVisibleVideo(c, viewer, videoID); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Video not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving video metadata"})
+		return
+	}
+
+	cursor, err := Mongo.GetCollection("videostore_captions").Find(c,
+		bson.M{"video_id": videoID},
+		options.Find().SetSort(bson.M{"language": 1}).SetProjection(bson.M{"content": 0}),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving caption tracks"})
+		return
+	}
+	defer cursor.Close(c)
+
+	tracks := make([]CaptionTrackItem, 0)
+	for cursor.Next(c) {
+		var track Schemas.CaptionTrack
+		if err := cursor.Decode(&track); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error decoding caption track"})
+			return
+		}
+		tracks = append(tracks, CaptionTrackItem{CaptionTrack: track, URL: captionURL(videoID, track.Language)})
+	}
+
+	if err := cursor.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Cursor error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tracks)
+}
+
+// Serves a caption track as WebVTT for the <track> element of the player
+func GetCaptionTrack(c *gin.Context) {
+	videoID := c.Param("video_id")
+	language := c.Param("language")
+
+	viewer, ok := videoViewer(c)
+	if !ok {
+		return
+	}
+
+	if _, err := findVisibleVideo(c, viewer, videoID); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Video not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving video metadata"})
+		return
+	}
+
+	var track Schemas.CaptionTrack
+	err := Mongo.GetCollection("videostore_captions").FindOne(c, bson.M{"video_id": videoID, "language": language}).Decode(&track)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Caption track not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving caption track"})
+		return
+	}
+
+	c.Header("Content-Type", "text/vtt; charset=utf-8")
+	c.Header("Cache-Control", "private, max-age=300")
+	c.Header("ETag", fmt.Sprintf(`"%s-%d"`, track.ID.Hex(), track.UpdatedAt.UnixNano()))
+	http.ServeContent(c.Writer, c.Request, "", track.UpdatedAt, strings.NewReader(track.Content))
+}
+
+// Adds or replaces the caption track of a video for one language. The file can be WebVTT or
+// SRT and is stored as WebVTT after its cues were checked.
+func UploadCaptionTrack(c *gin.Context) {
+	videoID := c.Param("video_id")
+	language := c.Param("language")
+	if !languagePattern.MatchString(language) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "language must be a language tag such as sl or en-GB"})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxCaptionSize+1024*1024)
+	file, err := c.FormFile("captions")
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"message": "Caption file is too large", "max_size": maxCaptionSize})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Error getting caption file"})
+		return
+	}
+	if file.Size > maxCaptionSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"message": "Caption file is too large", "max_size": maxCaptionSize})
+		return
+	}
+
+	videoMetadata, user, ok := authorizeVideoChange(c, videoID, c.PostForm("username"))
+	if !ok {
+		return
+	}
+
+	stream, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error opening caption file"})
+		return
+	}
+	defer stream.Close()
+
+	data, err := io.ReadAll(stream)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error reading caption file"})
+		return
+	}
+
+	captions, err := Media.ParseCaptions(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	// Cues past the end of the video could never be shown
+	if videoMetadata.Media != nil && videoMetadata.Media.Duration > 0 {
+		duration := time.Duration(videoMetadata.Media.Duration * float64(time.Second))
+		for _, cue := range captions.Cues {
+			if cue.Start > duration {
+				c.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("cue at %s starts after the end of the video", cue.Start)})
+				return
+			}
+		}
+	}
+
+	label := strings.TrimSpace(c.PostForm("label"))
+	if label == "" {
+		label = language
+	}
+
+	track := Schemas.CaptionTrack{
+		VideoId:    videoID,
+		Language:   language,
+		Label:      label,
+		Content:    captions.WebVTT(),
+		CueCount:   len(captions.Cues),
+		UploadedBy: user.Name,
+		UpdatedAt:  time.Now(),
+	}
+
+	err = Mongo.GetCollection("videostore_captions").FindOneAndUpdate(c,
+		bson.M{"video_id": videoID, "language": language},
+		bson.M{"$set": bson.M{
+			"label":       track.Label,
+			"content":     track.Content,
+			"cue_count":   track.CueCount,
+			"uploaded_by": track.UploadedBy,
+			"updated_at":  track.UpdatedAt,
+		}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&track)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving caption track"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Caption track saved successfully",
+		"track":   CaptionTrackItem{CaptionTrack: track, URL: captionURL(videoID, language)},
+	})
+}
+
+func DeleteCaptionTrack(c *gin.Context) {
+	videoID := c.Param("video_id")
+	language := c.Param("language")
+
+	if _, _, ok := authorizeVideoChange(c, videoID, c.Query("username")); !ok {
+		return
+	}
+
+	result, err := Mongo.GetCollection("videostore_captions").DeleteOne(c, bson.M{"video_id": videoID, "language": language})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error deleting caption track"})
+		return
+	}
+	if result.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Caption track not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Caption track deleted successfully"})
+}
@@ -0,0 +1,265 @@
+package Functions
+
+import (
+	"backend/Mongo"
+	"backend/Schemas"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	maxVideoChapters      = 100
+	maxChapterTitleLength = 100
+	maxVideoNoteLength    = 2000
+)
+
+// Checks that a position in seconds lies within the video, the end is only known for parsed MP4 files
+func checkVideoTime(video Schemas.Video, seconds float64) error {
+	if seconds < 0 || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return errors.New("time must not be negative")
+	}
+	if video.Media != nil && video.Media.Duration > 0 && seconds > video.Media.Duration {
+		return fmt.Errorf("time %s is past the end of the video", formatVideoTime(seconds))
+	}
+	return nil
+}
+
+// Formats seconds as m:ss or h:mm:ss, the way players show positions
+func formatVideoTime(seconds float64) string {
+	total := int(seconds)
+	if total >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", total/3600, total/60%60, total%60)
+	}
+	return fmt.Sprintf("%d:%02d", total/60, total%60)
+}
+
+type VideoChaptersRequest struct {
+	Username string                 `json:"username"`
+	Chapters []Schemas.VideoChapter `json:"chapters"`
+}
+
+// Replaces the chapters of a video, an empty list removes them
+func SetVideoChapters(c *gin.Context) {
+	videoID := c.Param("video_id")
+
+	var request VideoChaptersRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request"})
+		return
+	}
+
+	videoMetadata, _, ok := authorizeVideoChange(c, videoID, request.Username)
+	if !ok {
+		return
+	}
+
+	if len(request.Chapters) > maxVideoChapters {
+		c.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("at most %d chapters are allowed", maxVideoChapters)})
+		return
+	}
+
+	chapters := make([]Schemas.VideoChapter, 0, len(request.Chapters))
+	for _, chapter := range request.Chapters {
+		chapter.Title = strings.TrimSpace(chapter.Title)
+		if chapter.Title == "" || utf8.RuneCountInString(chapter.Title) > maxChapterTitleLength {
+			c.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("chapter titles must have 1 to %d characters", maxChapterTitleLength)})
+			return
+		}
+		if err := checkVideoTime(videoMetadata, chapter.Start); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("chapter %q: %v", chapter.Title, err)})
+			return
+		}
+		chapters = append(chapters, chapter)
+	}
+
+	sort.SliceStable(chapters, func(i, j int) bool { return chapters[i].Start < chapters[j].Start })
+	for i := 1; i < len(chapters); i++ {
+		if chapters[i].Start == chapters[i-1].Start {
+			c.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("two chapters start at %s", formatVideoTime(chapters[i].Start))})
+			return
+		}
+	}
+
+	_, err := Mongo.GetCollection("videostore").UpdateOne(c, bson.M{"video_id": videoID}, bson.M{"$set": bson.M{"chapters": chapters}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving chapters"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Chapters saved successfully", "chapters": chapters})
+}
+
+// Lists the public notes of a video together with the viewer's own private notes, ordered by time
+func GetVideoNotes(c *gin.Context) {
+	videoID := c.Param("video_id")
+
+	viewer, ok := videoViewer(c)
+	if !ok {
+		return
+	}
+
+	if _, err := findVisibleVideo(c, viewer, videoID); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Video not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving video metadata"})
+		return
+	}
+
+	filter := bson.M{"video_id": videoID, "public": true}
+	if viewer != nil {
+		filter = bson.M{"video_id": videoID, "$or": bson.A{
+			bson.M{"public": true},
+			bson.M{"username": viewer.Name},
+		}}
+	}
+
+	collection := Mongo.GetCollection("videostore_notes")
+	total, err := collection.CountDocuments(c, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error counting notes"})
+		return
+	}
+
+	page, limit := getPagination(c, "page", "limit", 50)
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "time", Value: 1}, {Key: "_id", Value: 1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit))
+
+	cursor, err := collection.Find(c, filter, findOptions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving notes"})
+		return
+	}
+	defer cursor.Close(c)
+
+	notes := make([]Schemas.VideoNote, 0)
+	if err := cursor.All(c, &notes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error decoding notes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"notes": notes,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+func CreateVideoNote(c *gin.Context) {
+	var note Schemas.VideoNote
+	if err := c.ShouldBindJSON(&note); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request"})
+		return
+	}
+
+	note.Text = strings.TrimSpace(note.Text)
+	if note.VideoId == "" || note.Username == "" || note.Text == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "video_id, username and text are required"})
+		return
+	}
+	if utf8.RuneCountInString(note.Text) > maxVideoNoteLength {
+		c.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("text must be at most %d characters", maxVideoNoteLength)})
+		return
+	}
+
+	user, err := getUserByUsername(c, note.Username)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving user data"})
+		return
+	}
+
+	video, err := findVisibleVideo(c, &user, note.VideoId)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Video not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving video metadata"})
+		return
+	}
+
+	if err := checkVideoTime(video, note.Time); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	note.ID = primitive.NewObjectID()
+	note.CreatedAt = time.Now()
+
+	_, err = Mongo.GetCollection("videostore_notes").InsertOne(c, note)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating note"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Note added successfully", "note": note})
+}
+
+// Authors can delete their own notes, moderators can remove public ones
+func DeleteVideoNote(c *gin.Context) {
+	noteId := c.Query("note_id")
+	username := c.Query("username")
+	if noteId == "" || username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "note_id and username are required"})
+		return
+	}
+
+	objId, err := primitive.ObjectIDFromHex(noteId)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid note_id"})
+		return
+	}
+
+	collection := Mongo.GetCollection("videostore_notes")
+
+	var note Schemas.VideoNote
+	err = collection.FindOne(c, bson.M{"_id": objId}).Decode(&note)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Note not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving note"})
+		return
+	}
+
+	if note.Username != username {
+		user, err := getUserByUsername(c, username)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving user data"})
+			return
+		}
+		if err != nil || !user.Admin || !note.Public {
+			c.JSON(http.StatusForbidden, gin.H{"message": "You are not authorized to delete this note"})
+			return
+		}
+	}
+
+	_, err = collection.DeleteOne(c, bson.M{"_id": objId})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error deleting note"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Note deleted successfully"})
+}
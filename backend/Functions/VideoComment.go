@@ -0,0 +1,223 @@
+package Functions
+
+import (
+	"backend/Mongo"
+	"backend/Schemas"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Looks up a video the viewer is allowed to open
+func findVisibleVideo(ctx context.Context, viewer *Schemas.User, videoID string) (Schemas.Video, error) {
+	filter := visibleVideoFilter(viewer, false)
+	filter["video_id"] = videoID
+
+	var video Schemas.Video
+	err := Mongo.GetCollection("videostore").FindOne(ctx, filter).Decode(&video)
+	return video, err
+}
+
+func GetVideoComments(c *gin.Context) {
+	videoID := c.Query("video_id")
+	if videoID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "video_id is required"})
+		return
+	}
+
+	// Video comments have no replies, so they can not be sorted by them
+	sortMode := c.DefaultQuery("sort", "oldest")
+	if sortMode != "oldest" && sortMode != "newest" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "sort must be oldest or newest"})
+		return
+	}
+
+	viewer, ok := videoViewer(c)
+	if !ok {
+		return
+	}
+
+	if _, err := findVisibleVideo(c, viewer, videoID); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Video not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving video metadata"})
+		return
+	}
+
+	collection := Mongo.GetCollection("videostore_comments")
+	filter := bson.M{"video_id": videoID}
+
+	total, err := collection.CountDocuments(c, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error counting comments"})
+		return
+	}
+
+	page, limit := getPagination(c, "page", "limit", 20)
+	findOptions := options.Find().
+		SetSort(commentSortOrder(sortMode)).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit))
+
+	cursor, err := collection.Find(c, filter, findOptions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving comments"})
+		return
+	}
+	defer cursor.Close(c)
+
+	comments := make([]Schemas.VideoComment, 0)
+	if err := cursor.All(c, &comments); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error decoding comments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"comments": comments,
+		"total":    total,
+		"page":     page,
+		"limit":    limit,
+	})
+}
+
+func CreateVideoComment(c *gin.Context) {
+	var comment Schemas.VideoComment
+	if err := c.ShouldBindJSON(&comment); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request"})
+		return
+	}
+
+	comment.Description = strings.TrimSpace(comment.Description)
+	if comment.VideoId == "" || comment.Username == "" || comment.Description == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "video_id, username and description are required"})
+		return
+	}
+
+	user, err := getUserByUsername(c, comment.Username)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving user data"})
+		return
+	}
+
+	// Users can only comment on videos they are allowed to watch
+	video, err := findVisibleVideo(c, &user, comment.VideoId)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Video not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving video metadata"})
+		return
+	}
+
+	comment.ID = primitive.NewObjectID()
+	comment.Date = time.Now()
+
+	_, err = Mongo.GetCollection("videostore_comments").InsertOne(c, comment)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating comment"})
+		return
+	}
+
+	_, err = Mongo.GetCollection("videostore").UpdateOne(c, bson.M{"video_id": comment.VideoId}, bson.M{"$inc": bson.M{"comment_count": 1}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating comment count"})
+		return
+	}
+
+	err = createNotification(c, Schemas.Notification{
+		Username:  video.Uploader,
+		Type:      Schemas.NotificationVideoComment,
+		Actor:     comment.Username,
+		Message:   fmt.Sprintf("%s commented on your video: %s", comment.Username, video.VideoName),
+		CommentId: comment.ID.Hex(),
+		VideoId:   comment.VideoId,
+	})
+	if err != nil {
+		log.Printf("(CreateVideoComment) Error notifying %s: %v", video.Uploader, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Comment added successfully", "comment": comment})
+}
+
+// Authors can delete their own comments, moderators can remove any comment
+func DeleteVideoComment(c *gin.Context) {
+	commentId := c.Query("comment_id")
+	username := c.Query("username")
+	if commentId == "" || username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "comment_id and username are required"})
+		return
+	}
+
+	objId, err := primitive.ObjectIDFromHex(commentId)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid comment_id"})
+		return
+	}
+
+	collection := Mongo.GetCollection("videostore_comments")
+
+	var comment Schemas.VideoComment
+	err = collection.FindOne(c, bson.M{"_id": objId}).Decode(&comment)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Comment not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving comment"})
+		return
+	}
+
+	if comment.Username != username {
+		user, err := getUserByUsername(c, username)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving user data"})
+			return
+		}
+		if err != nil || !user.Admin {
+			c.JSON(http.StatusForbidden, gin.H{"message": "You are not authorized to delete this comment"})
+			return
+		}
+	}
+
+	result, err := collection.DeleteOne(c, bson.M{"_id": objId})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error deleting comment"})
+		return
+	}
+
+	if err := closeReports(c, Schemas.ReportVideoComment, commentId); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error closing reports"})
+		return
+	}
+
+	// A concurrent delete already took care of the count
+	if result.DeletedCount > 0 {
+		_, err = Mongo.GetCollection("videostore").UpdateOne(c,
+			bson.M{"video_id": comment.VideoId, "comment_count": bson.M{"$gt": 0}},
+			bson.M{"$inc": bson.M{"comment_count": -1}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating comment count"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Comment deleted successfully"})
+}
@@ -0,0 +1,177 @@
+package Functions
+
+import (
+	"backend/Mongo"
+	"backend/Schemas"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Number of earlier versions kept for a video, older ones are dropped
+const maxVideoEditHistory = 50
+
+// Fields left out of the request keep their current value
+type VideoEditRequest struct {
+	Username    string    `json:"username"`
+	Title       *string   `json:"title"`
+	Description *string   `json:"description"`
+	Tags        *[]string `json:"tags"`
+	Visibility  *string   `json:"visibility"`
+	CourseGroup *string   `json:"course_group"`
+	PublishAt   *string   `json:"publish_at"` // An empty string publishes right away
+}
+
+// Loads a video for a change that only its uploader and moderators may make,
+// when ok is false the error response is already written
+func authorizeVideoChange(c *gin.Context, videoID string, username string) (video Schemas.Video, user Schemas.User, ok bool) {
+	if username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "username is required"})
+		return
+	}
+
+	user, err := getUserByUsername(c, username)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving user data"})
+		return
+	}
+
+	err = Mongo.GetCollection("videostore").FindOne(c, bson.M{"video_id": videoID}).Decode(&video)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Video not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving video metadata"})
+		return
+	}
+
+	if video.Uploader != user.Name && !user.Admin {
+		c.JSON(http.StatusForbidden, gin.H{"message": "You are not authorized to change this video"})
+		return
+	}
+
+	return video, user, true
+}
+
+// Lets the uploader or a moderator change a video's details and who can see it
+func EditVideo(c *gin.Context) {
+	videoID := c.Param("video_id")
+
+	var request VideoEditRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request"})
+		return
+	}
+
+	if request.Title == nil && request.Description == nil && request.Tags == nil &&
+		request.Visibility == nil && request.CourseGroup == nil && request.PublishAt == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Nothing to update"})
+		return
+	}
+
+	videoMetadata, user, ok := authorizeVideoChange(c, videoID, request.Username)
+	if !ok {
+		return
+	}
+
+	title := videoMetadata.VideoName
+	if request.Title != nil {
+		title = strings.TrimSpace(*request.Title)
+	}
+	description := videoMetadata.Description
+	if request.Description != nil {
+		description = *request.Description
+	}
+	tags := videoMetadata.Tags
+	if request.Tags != nil {
+		tags = normalizeTags(*request.Tags)
+	}
+
+	if err := validateVideoDetails(title, description, tags); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	visibility := videoMetadata.Visibility
+	if request.Visibility != nil {
+		visibility = *request.Visibility
+	}
+	courseGroup := videoMetadata.CourseGroup
+	if request.CourseGroup != nil {
+		courseGroup = *request.CourseGroup
+	}
+	publishAt := ""
+	if videoMetadata.PublishAt != nil {
+		publishAt = videoMetadata.PublishAt.Format(time.RFC3339Nano)
+	}
+	if request.PublishAt != nil {
+		publishAt = *request.PublishAt
+	}
+
+	access, err := parseVideoAccess(visibility, courseGroup, publishAt)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	edit := Schemas.VideoEdit{
+		EditedBy:    user.Name,
+		EditedAt:    time.Now(),
+		VideoName:   videoMetadata.VideoName,
+		Description: videoMetadata.Description,
+		Tags:        videoMetadata.Tags,
+		Visibility:  videoMetadata.Visibility,
+		CourseGroup: videoMetadata.CourseGroup,
+		PublishAt:   videoMetadata.PublishAt,
+	}
+
+	var updated Schemas.Video
+	err = Mongo.GetCollection("videostore").FindOneAndUpdate(c,
+		bson.M{"video_id": videoID},
+		bson.M{
+			"$set": bson.M{
+				"video_name":   title,
+				"description":  description,
+				"tags":         tags,
+				"visibility":   access.Visibility,
+				"course_group": access.CourseGroup,
+				"publish_at":   access.PublishAt,
+			},
+			"$push": bson.M{"edit_history": bson.M{"$each": bson.A{edit}, "$slice": -maxVideoEditHistory}},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating video metadata"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Video updated successfully", "video": newVideoListItem(updated)})
+}
+
+// Lists the earlier versions of a video's details, newest first. The history can include private
+// details, so only the uploader and moderators can see it.
+func GetVideoEditHistory(c *gin.Context) {
+	videoMetadata, _, ok := authorizeVideoChange(c, c.Param("video_id"), c.Query("username"))
+	if !ok {
+		return
+	}
+
+	history := make([]Schemas.VideoEdit, 0, len(videoMetadata.EditHistory))
+	for i := len(videoMetadata.EditHistory) - 1; i >= 0; i-- {
+		history = append(history, videoMetadata.EditHistory[i])
+	}
+
+	c.JSON(http.StatusOK, gin.H{"video_id": videoMetadata.VideoID, "edit_history": history})
+}
@@ -0,0 +1,221 @@
+package Functions
+
+import (
+	"backend/Config"
+	"backend/Mongo"
+	"backend/Schemas"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Flag score at which a video is hidden from everyone but moderators
+func flagHideThreshold() float64 {
+	return float64(Config.GetENVInt("FLAG_HIDE_THRESHOLD", 4))
+}
+
+// How much a user's flag adds to the score. Without FLAG_REPUTATION_WEIGHTING every flag counts once.
+func flagWeight(user Schemas.User) float64 {
+	if Config.GetENVInt("FLAG_REPUTATION_WEIGHTING", 0) == 0 || user.FlagReputation == nil {
+		return 1
+	}
+	return *user.FlagReputation
+}
+
+// Query condition for videos hidden by flags. Videos flagged before scores existed only have
+// the flag count, which is what their score would be with every flag counting once.
+func hiddenByFlags() bson.M {
+	threshold := flagHideThreshold()
+	return bson.M{"$or": bson.A{
+		bson.M{"flag_score": bson.M{"$gte": threshold}},
+		bson.M{"flag_score": bson.M{"$exists": false}, "flagged": bson.M{"$gte": threshold}},
+	}}
+}
+
+func videoFlagScore(video Schemas.Video) float64 {
+	if video.FlagScore == nil {
+		return float64(video.Flagged)
+	}
+	return *video.FlagScore
+}
+
+// Adds a flag to the video's counters, older videos start their score from the flag count
+func addFlagUpdate(userID string, weight float64) bson.A {
+	return bson.A{bson.M{"$set": bson.M{
+		"flagged":    bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$flagged", 0}}, 1}},
+		"flag_score": bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$flag_score", bson.M{"$ifNull": bson.A{"$flagged", 0}}}}, weight}},
+		"flagged_by": bson.M{"$concatArrays": bson.A{bson.M{"$ifNull": bson.A{"$flagged_by", bson.A{}}}, bson.A{userID}}},
+	}}}
+}
+
+// Takes a flag off the video's counters. Flags cleared by a moderator no longer count, so only
+// the flagger is removed for them.
+func removeFlagUpdate(userID string, weight float64, cleared bool) bson.A {
+	set := bson.M{
+		"flagged_by": bson.M{"$filter": bson.M{
+			"input": bson.M{"$ifNull": bson.A{"$flagged_by", bson.A{}}},
+			"cond":  bson.M{"$ne": bson.A{"$$this", userID}},
+		}},
+	}
+	if !cleared {
+		set["flagged"] = bson.M{"$max": bson.A{0, bson.M{"$subtract": bson.A{bson.M{"$ifNull": bson.A{"$flagged", 0}}, 1}}}}
+		set["flag_score"] = bson.M{"$max": bson.A{0, bson.M{"$subtract": bson.A{bson.M{"$ifNull": bson.A{"$flag_score", bson.M{"$ifNull": bson.A{"$flagged", 0}}}}, weight}}}}
+	}
+	return bson.A{bson.M{"$set": set}}
+}
+
+// Withdraws the caller's flag from a video
+func RetractVideoFlag(c *gin.Context) {
+	videoID := c.Query("video_id")
+	userID := c.Query("user_id")
+	if videoID == "" || userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "video_id and user_id are required"})
+		return
+	}
+
+	retractVideoFlag(c, videoID, userID)
+}
+
+// Withdraws a flag, also used for video reports. The error or success response is written here.
+func retractVideoFlag(c *gin.Context, videoID string, userID string) {
+	var flag Schemas.VideoFlag
+	err := Mongo.GetCollection("videostore_flags").FindOneAndDelete(c, bson.M{"_id": videoID + ":" + userID}).Decode(&flag)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retracting flag"})
+		return
+	}
+
+	// Flags from before reasons were recorded only exist in flagged_by, they counted once
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		flag = Schemas.VideoFlag{VideoId: videoID, UserID: userID, Weight: 1}
+	}
+
+	result, err := Mongo.GetCollection("videostore").UpdateOne(c,
+		bson.M{"video_id": videoID, "flagged_by": userID},
+		removeFlagUpdate(userID, flag.Weight, flag.Cleared),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating video flags"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"message": "You have not flagged this video"})
+		return
+	}
+
+	if !flag.Cleared {
+		if err := untrackReport(c, Schemas.ReportVideo, videoID, flag.Weight); err != nil {
+			fmt.Printf("Error tracking report on video %s: %v\n", videoID, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Flag retracted successfully"})
+}
+
+// Lists the flags on a video with a count per reason, for moderators only
+func GetVideoFlags(c *gin.Context) {
+	videoID := c.Param("video_id")
+
+	adminUsername := c.Query("admin_username")
+	if adminUsername == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "admin_username is required"})
+		return
+	}
+
+	admin, err := getUserByUsername(c, adminUsername)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Admin user not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving user data"})
+		return
+	}
+	if !admin.Admin {
+		c.JSON(http.StatusForbidden, gin.H{"message": "You are not authorized to view flags"})
+		return
+	}
+
+	var video Schemas.Video
+	err = Mongo.GetCollection("videostore").FindOne(c, bson.M{"video_id": videoID}).Decode(&video)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Video not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving video metadata"})
+		return
+	}
+
+	cursor, err := Mongo.GetCollection("videostore_flags").Find(c,
+		bson.M{"video_id": videoID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving flags"})
+		return
+	}
+	defer cursor.Close(c)
+
+	flags := make([]Schemas.VideoFlag, 0)
+	if err := cursor.All(c, &flags); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error decoding flags"})
+		return
+	}
+
+	reasons := make(map[string]int)
+	for _, flag := range flags {
+		if !flag.Cleared {
+			reasons[flag.Reason]++
+		}
+	}
+
+	score := videoFlagScore(video)
+	c.JSON(http.StatusOK, gin.H{
+		"video_id":   videoID,
+		"flagged":    video.Flagged,
+		"flag_score": score,
+		"threshold":  flagHideThreshold(),
+		"hidden":     score >= flagHideThreshold(),
+		"reasons":    reasons,
+		"flags":      flags,
+	})
+}
+
+// Checks the flagger and loads the video for a new flag, videos the flagger can not see can not be flagged.
+// When ok is false the error response is already written
+func flagTarget(c *gin.Context, videoID string, userID string) (video Schemas.Video, user Schemas.User, ok bool) {
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid user_id format"})
+		return
+	}
+
+	err = Mongo.GetCollection("users").FindOne(c, bson.M{"_id": userObjectID}).Decode(&user)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Invalid user"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error verifying user", "error": err.Error()})
+		return
+	}
+
+	video, err = findVisibleVideo(c, &user, videoID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Video not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving video metadata"})
+		return
+	}
+
+	return video, user, true
+}
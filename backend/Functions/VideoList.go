@@ -0,0 +1,109 @@
+package Functions
+
+import (
+	"backend/Mongo"
+	"backend/Schemas"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Video metadata as returned by the JSON listing, with links for playback, download and the thumbnail
+type VideoListItem struct {
+	Schemas.Video
+	StreamURL    string `json:"stream_url"`
+	DownloadURL  string `json:"download_url"`
+	ThumbnailURL string `json:"thumbnail_url"`
+	// Seconds to resume playback from, only set for signed in viewers who started the video
+	ResumePosition *float64 `json:"resume_position,omitempty"`
+}
+
+func newVideoListItem(video Schemas.Video) VideoListItem {
+	return VideoListItem{
+		Video:        video,
+		StreamURL:    "/videostore/stream/" + video.VideoID,
+		DownloadURL:  "/videostore/video" + video.VideoID,
+		ThumbnailURL: thumbnailURL(video),
+	}
+}
+
+// Mongo sort order for a video listing sort mode, unknown modes fall back to newest first
+func videoSortOrder(sortMode string) bson.D {
+	switch sortMode {
+	case "views":
+		return bson.D{{Key: "views", Value: -1}, {Key: "posted_at", Value: -1}}
+	case "likes":
+		return bson.D{{Key: "likes", Value: -1}, {Key: "posted_at", Value: -1}}
+	case "flagged":
+		return bson.D{{Key: "flag_score", Value: -1}, {Key: "flagged", Value: -1}, {Key: "posted_at", Value: -1}}
+	default:
+		return bson.D{{Key: "posted_at", Value: -1}}
+	}
+}
+
+// Lists video metadata as JSON without touching the video files
+func ListVideos(c *gin.Context) {
+	viewer, ok := videoViewer(c)
+	if !ok {
+		return
+	}
+
+	filter := visibleVideoFilter(viewer, true)
+
+	if uploader := c.Query("uploader"); uploader != "" {
+		filter["uploader_username"] = uploader
+	}
+
+	if tags := normalizeTags(c.QueryArray("tags")); len(tags) > 0 {
+		filter["tags"] = tagFilter(tags, c.DefaultQuery("match", "all"))
+	}
+
+	collection := Mongo.GetCollection("videostore")
+	total, err := collection.CountDocuments(c, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error counting videos"})
+		return
+	}
+
+	page, limit := getPagination(c, "page", "limit", 20)
+	findOptions := options.Find().
+		SetSort(videoSortOrder(c.Query("sort"))).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit))
+
+	cursor, err := collection.Find(c, filter, findOptions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error querying video metadata"})
+		return
+	}
+	defer cursor.Close(c)
+
+	videos := make([]VideoListItem, 0)
+	for cursor.Next(c) {
+		var videoMetadata Schemas.Video
+		if err := cursor.Decode(&videoMetadata); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error decoding video metadata"})
+			return
+		}
+		videos = append(videos, newVideoListItem(videoMetadata))
+	}
+
+	if err := cursor.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Cursor error"})
+		return
+	}
+
+	if err := attachResumePositions(c, viewer, videos); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving watch progress"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"videos": videos,
+		"total":  total,
+		"page":   page,
+		"limit":  limit,
+	})
+}
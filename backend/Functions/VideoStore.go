@@ -2,25 +2,38 @@ package Functions
 
 import (
 	"archive/zip"
+	"backend/Media"
 	"backend/Mongo"
 	"backend/Schemas"
+	"backend/Storage"
 	"context"
 	"errors"
 	"fmt"
+	"image"
+	"io"
+	"mime"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/gridfs"
 )
 
 func UploadVideo(c *gin.Context) {
+	// Cap the body at the largest limit of any role, the uploader's own limit is checked below
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxVideoSizeAnyRole()+1024*1024)
+
 	// Get file from the request
 	file, err := c.FormFile("video")
 	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"message": "Video file is too large"})
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Error getting video file"})
 		return
 	}
@@ -34,60 +47,125 @@ func UploadVideo(c *gin.Context) {
 	defer fileStream.Close()
 
 	// Get video title from form data (renamed from video_name to title)
-	videoTitle := c.PostForm("title")
-	if videoTitle == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "title is required"})
+	videoTitle := strings.TrimSpace(c.PostForm("title"))
+	description := c.PostForm("description")
+	tags := uploadTags(c) // Expecting 'flags' from the frontend
+	if err := validateVideoDetails(videoTitle, description, tags); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
 
-	// Query the database for existing videos with the same title
-	collection := Mongo.GetCollection("videostore")
-	cursor, err := collection.Find(context.TODO(), bson.M{"video_name": videoTitle})
+	// Public unless the uploader picks something else, publish_at delays the release
+	access, err := parseVideoAccess(c.PostForm("visibility"), c.PostForm("course_group"), c.PostForm("publish_at"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	// Optional poster image, checked before anything is stored
+	var posterImage image.Image
+	if posterFile, err := c.FormFile("poster"); err == nil {
+		posterImage, err = readPosterImage(posterFile)
+		if err != nil {
+			respondPosterError(c, err)
+			return
+		}
+	}
+
+	uploaderUsername := c.PostForm("uploader_username")
+	sizeLimit, err := uploadLimitFor(context.TODO(), uploaderUsername)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Uploader not found"})
+			return
+		}
+		if errors.Is(err, errUploaderBanned) {
+			c.JSON(http.StatusForbidden, gin.H{"message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving user data", "error": err.Error()})
+		return
+	}
+
+	if file.Size > sizeLimit {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"message": "Video file is too large", "max_size": sizeLimit})
+		return
+	}
+
+	// Verify the actual container instead of trusting the file name or MIME type
+	container, videoStream, err := sniffVideo(fileStream, file.Filename)
+	if err != nil {
+		if errors.Is(err, errUnsupportedVideo) || errors.Is(err, errDisguisedVideo) {
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error reading video file"})
+		return
+	}
+
+	uniqueFilename, err := uniqueVideoFilename(videoTitle)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error querying video title count"})
 		return
 	}
-	defer cursor.Close(context.TODO())
 
-	// Count existing videos with the same title
-	count := 0
-	for cursor.Next(context.TODO()) {
-		count++
+	// Connect to the media storage
+	storage, err := Storage.Default()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error opening media storage"})
+		return
 	}
 
-	// Generate a unique filename by appending index and timestamp
-	uniqueFilename := fmt.Sprintf("%s_%d_%d", videoTitle, count+1, time.Now().UnixNano())
-	// Connect to GridFS bucket
-	client := Mongo.GetMongoDB()
-	bucket, err := gridfs.NewBucket(client.Database("Pametni-Paketnik-baza"))
+	// Upload to the media storage, identical files are stored only once
+	blob, err := storeVideoBlob(context.TODO(), storage, uniqueFilename, videoStream)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating GridFS bucket"})
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error uploading to media storage", "error": err.Error()})
 		return
 	}
 
-	// Upload to GridFS
-	videoID, err := bucket.UploadFromStream(uniqueFilename, fileStream)
+	// Files whose boxes cannot be parsed would not play either, so they are rejected
+	media, err := probeVideo(context.TODO(), storage, container, blob)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error uploading to GridFS", "error": err.Error()})
+		releaseVideoBlob(context.TODO(), storage, Schemas.Video{BlobID: blob.BlobID, SHA256: blob.SHA256})
+		if errors.Is(err, Media.ErrInvalidMP4) {
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error reading video file", "error": err.Error()})
 		return
 	}
 
-	// Create video metadata using the Video schema
-	videoMetadata := Schemas.Video{
-		ID:          primitive.NewObjectID(),
-		VideoName:   videoTitle, // Passed from the user
-		Uploader:    c.PostForm("uploader_username"),
-		Description: c.PostForm("description"),
-		Tags:        c.PostFormArray("flags"), // Expecting 'flags' from the frontend
-		VideoID:     videoID.Hex(),
-		Comments:    []Schemas.Comment{}, // Initialize empty comments
-		PostedAt:    time.Now(),
-		Flagged:     0,
+	var poster *Schemas.VideoPoster
+	if posterImage != nil {
+		poster, err = storePosterVariants(context.TODO(), storage, uniqueFilename, posterImage)
+		if err != nil {
+			releaseVideoBlob(context.TODO(), storage, Schemas.Video{BlobID: blob.BlobID, SHA256: blob.SHA256})
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error storing poster image", "error": err.Error()})
+			return
+		}
 	}
 
-	// Save metadata to the 'videostore' collection
-	_, err = Mongo.GetCollection("videostore").InsertOne(context.TODO(), videoMetadata)
+	// Create video metadata using the Video schema and save it to the 'videostore' collection
+	videoMetadata, err := saveVideoMetadata(Schemas.Video{
+		VideoName:   videoTitle, // Passed from the user
+		Uploader:    uploaderUsername,
+		Description: description,
+		Tags:        tags,
+		VideoID:     Storage.NewID(),
+		BlobID:      blob.BlobID,
+		SHA256:      blob.SHA256,
+		ContentType: container.ContentType,
+		Filename:    file.Filename,
+		Size:        blob.Size,
+		Media:       media,
+		Poster:      poster,
+		Visibility:  access.Visibility,
+		CourseGroup: access.CourseGroup,
+		PublishAt:   access.PublishAt,
+	})
 	if err != nil {
+		releaseVideoBlob(context.TODO(), storage, Schemas.Video{BlobID: blob.BlobID, SHA256: blob.SHA256})
+		deletePosterVariants(context.TODO(), storage, poster)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving video metadata", "error": err.Error()})
 		return
 	}
@@ -95,11 +173,38 @@ func UploadVideo(c *gin.Context) {
 	// Return success response
 	c.JSON(http.StatusOK, gin.H{
 		"message":   "Video uploaded successfully",
-		"video_id":  videoID.Hex(),
+		"video_id":  videoMetadata.VideoID,
+		"sha256":    videoMetadata.SHA256,
 		"posted_at": videoMetadata.PostedAt.Format(time.RFC3339),
 	})
 }
 
+// Generates a unique GridFS filename by appending the title index and a timestamp
+func uniqueVideoFilename(videoTitle string) (string, error) {
+	// Count existing videos with the same title
+	count, err := Mongo.GetCollection("videostore").CountDocuments(context.TODO(), bson.M{"video_name": videoTitle})
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s_%d_%d", videoTitle, count+1, time.Now().UnixNano()), nil
+}
+
+// Stores the metadata document for a video whose file is already in GridFS
+func saveVideoMetadata(videoMetadata Schemas.Video) (Schemas.Video, error) {
+	videoMetadata.ID = primitive.NewObjectID()
+	videoMetadata.CommentCount = 0
+	videoMetadata.PostedAt = time.Now()
+	videoMetadata.Flagged = 0
+	videoMetadata.FlagScore = new(float64)
+	if videoMetadata.Visibility == "" {
+		videoMetadata.Visibility = Schemas.VideoPublic
+	}
+
+	_, err := Mongo.GetCollection("videostore").InsertOne(context.TODO(), videoMetadata)
+	return videoMetadata, err
+}
+
 func GetVideo(c *gin.Context) {
 	videoID := c.Param("id")
 	if videoID == "" {
@@ -108,24 +213,30 @@ func GetVideo(c *gin.Context) {
 	}
 	fmt.Printf("Received video_id: %s\n", videoID)
 
-	// Connect to MongoDB and GridFS
-	client := Mongo.GetMongoDB()
-	bucket, err := gridfs.NewBucket(client.Database("Pametni-Paketnik-baza"))
+	// Connect to the media storage
+	storage, err := Storage.Default()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating GridFS bucket"})
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error opening media storage"})
 		return
 	}
 
-	// Convert video_id to ObjectID
-	objectID, err := primitive.ObjectIDFromHex(videoID)
-	if err != nil {
+	// Validate video_id
+	if _, err := primitive.ObjectIDFromHex(videoID); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid video_id"})
 		return
 	}
 
-	// Retrieve video metadata excluding flagged videos
+	viewer, ok := videoViewer(c)
+	if !ok {
+		return
+	}
+
+	// Retrieve video metadata excluding flagged videos and ones the viewer may not see
+	filter := visibleVideoFilter(viewer, false)
+	filter["video_id"] = videoID
+
 	var videoMetadata Schemas.Video
-	err = Mongo.GetCollection("videostore").FindOne(context.TODO(), bson.M{"video_id": videoID, "flagged": bson.M{"$lte": 3}}).Decode(&videoMetadata)
+	err = Mongo.GetCollection("videostore").FindOne(context.TODO(), filter).Decode(&videoMetadata)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Video not found or flagged"})
 		return
@@ -147,31 +258,21 @@ func GetVideo(c *gin.Context) {
 	}
 
 	// Write video metadata to metadata.txt
-	metadataContent := fmt.Sprintf(
-		"Video Name: %s\nUploader: %s\nDescription: %s\nTags: %v\nPosted At: %s\nVideo ID: %s\nFlagged Count: %d\n",
-		videoMetadata.VideoName,
-		videoMetadata.Uploader,
-		videoMetadata.Description,
-		videoMetadata.Tags,
-		videoMetadata.PostedAt.Format(time.RFC3339),
-		videoMetadata.VideoID,
-		videoMetadata.Flagged,
-	)
-	_, err = metadataFile.Write([]byte(metadataContent))
+	_, err = metadataFile.Write([]byte(videoMetadataContent(videoMetadata)))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error writing metadata file"})
 		return
 	}
 
 	// Add video file to the ZIP archive
-	videoFile, err := zipWriter.Create(fmt.Sprintf("%s.mp4", videoMetadata.VideoName))
+	videoFile, err := zipWriter.Create(videoMetadata.VideoName + videoExtension(videoMetadata))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating video file entry in ZIP"})
 		return
 	}
 
 	// Stream video data into the ZIP file
-	_, err = bucket.DownloadToStream(objectID, videoFile)
+	err = copyVideoBlob(context.TODO(), storage, videoBlobID(videoMetadata), videoFile)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error streaming video to ZIP", "error": err.Error()})
 		return
@@ -182,100 +283,32 @@ func GetVideo(c *gin.Context) {
 }
 
 func GetAllVideos(c *gin.Context) {
-	client := Mongo.GetMongoDB()
+	viewer, ok := videoViewer(c)
+	if !ok {
+		return
+	}
+
 	collection := Mongo.GetCollection("videostore")
-	bucket, err := gridfs.NewBucket(client.Database("Pametni-Paketnik-baza"))
+	storage, err := Storage.Default()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating GridFS bucket"})
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error opening media storage"})
 		return
 	}
 
-	// Query all videos excluding flagged ones
-	cursor, err := collection.Find(context.TODO(), bson.M{"flagged": bson.M{"$lte": 3}})
+	// Query all listed videos excluding flagged ones
+	cursor, err := collection.Find(context.TODO(), visibleVideoFilter(viewer, true))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error querying video metadata"})
 		return
 	}
 	defer cursor.Close(context.TODO())
 
-	// Set response headers for ZIP file
-	c.Header("Content-Type", "application/zip")
-	c.Header("Content-Disposition", `attachment; filename="all_videos_with_metadata.zip"`)
-
-	// Create a ZIP writer
-	zipWriter := zip.NewWriter(c.Writer)
-	defer zipWriter.Close()
-
-	index := 1
-	videoCount := 0
-
-	for cursor.Next(context.TODO()) {
-		var videoMetadata Schemas.Video
-		if err := cursor.Decode(&videoMetadata); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error decoding video metadata"})
-			return
-		}
-
-		// Convert video_id to ObjectID
-		objectID, err := primitive.ObjectIDFromHex(videoMetadata.VideoID)
-		if err != nil {
-			fmt.Printf("Invalid ObjectID: %v\n", err)
-			continue
-		}
-
-		// Add metadata.txt file for this video with an index
-		metadataFile, err := zipWriter.Create(fmt.Sprintf("%s_%d_metadata.txt", videoMetadata.VideoName, index))
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating metadata file"})
-			return
-		}
-
-		metadataContent := fmt.Sprintf(
-			"Video Name: %s\nUploader: %s\nDescription: %s\nTags: %v\nPosted At: %s\nVideo ID: %s\nFlagged Count: %d\\n",
-			videoMetadata.VideoName,
-			videoMetadata.Uploader,
-			videoMetadata.Description,
-			videoMetadata.Tags,
-			videoMetadata.PostedAt.Format(time.RFC3339),
-			videoMetadata.VideoID, // Include the video_id here
-			videoMetadata.Flagged,
-		)
-
-		_, err = metadataFile.Write([]byte(metadataContent))
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error writing metadata file"})
-			return
-		}
-
-		// Add the video file itself with an index
-		videoFile, err := zipWriter.Create(fmt.Sprintf("%s_%d.mp4", videoMetadata.VideoName, index))
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating video file in ZIP"})
-			return
-		}
-
-		_, err = bucket.DownloadToStream(objectID, videoFile)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error streaming video to ZIP", "error": err.Error()})
-			return
-		}
-
-		index++
-		videoCount++
-	}
-
-	if err := cursor.Err(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Cursor error"})
-		return
-	}
-
-	if videoCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"message": "No videos found in the database"})
-		return
-	}
-
-	fmt.Printf("Total videos added to ZIP: %d\n", videoCount)
-	c.Status(http.StatusOK)
+	writeVideosZip(c, cursor, storage, videosZip{
+		Name:          "all_videos_with_metadata.zip",
+		EmptyMessage:  "No videos found in the database",
+		StreamMessage: "Error streaming video to ZIP",
+		Kind:          "videos",
+	})
 }
 
 func GetAllVideosByName(c *gin.Context) {
@@ -285,36 +318,111 @@ func GetAllVideosByName(c *gin.Context) {
 		return
 	}
 
+	viewer, ok := videoViewer(c)
+	if !ok {
+		return
+	}
+
 	// Connect to MongoDB and GridFS
-	client := Mongo.GetMongoDB()
 	collection := Mongo.GetCollection("videostore")
-	bucket, err := gridfs.NewBucket(client.Database("Pametni-Paketnik-baza"))
+	storage, err := Storage.Default()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating GridFS bucket"})
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error opening media storage"})
 		return
 	}
 
-	// Query for all videos matching the video_name and flagged count
-	cursor, err := collection.Find(context.TODO(), bson.M{"video_name": videoName, "flagged": bson.M{"$lte": 3}})
+	// Query for all listed videos matching the video_name and flagged count
+	filter := visibleVideoFilter(viewer, true)
+	filter["video_name"] = videoName
+
+	cursor, err := collection.Find(context.TODO(), filter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error querying video metadata"})
 		return
 	}
 	defer cursor.Close(context.TODO())
 
+	writeVideosZip(c, cursor, storage, videosZip{
+		Name:          "videos_with_metadata.zip",
+		EmptyMessage:  "No videos found with the given name",
+		StreamMessage: "Error streaming video",
+		Kind:          "videos",
+	})
+}
+
+// Copies a stored video file into a writer such as a ZIP entry
+func copyVideoBlob(ctx context.Context, storage Storage.Backend, blobID string, destination io.Writer) error {
+	reader, err := storage.Get(ctx, blobID, 0, -1)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	_, err = io.Copy(destination, reader)
+	return err
+}
+
+// Formats the metadata.txt entry stored next to every video in a ZIP download
+func videoMetadataContent(videoMetadata Schemas.Video) string {
+	content := fmt.Sprintf(
+		"Video Name: %s\nUploader: %s\nDescription: %s\nTags: %v\nPosted At: %s\nVideo ID: %s\nFlagged Count: %d\nSHA-256: %s\n",
+		videoMetadata.VideoName,
+		videoMetadata.Uploader,
+		videoMetadata.Description,
+		videoMetadata.Tags,
+		videoMetadata.PostedAt.Format(time.RFC3339),
+		videoMetadata.VideoID,
+		videoMetadata.Flagged,
+		videoMetadata.SHA256,
+	)
+
+	if len(videoMetadata.Chapters) > 0 {
+		content += "Chapters:\n"
+		for _, chapter := range videoMetadata.Chapters {
+			content += fmt.Sprintf("  %s %s\n", formatVideoTime(chapter.Start), chapter.Title)
+		}
+	}
+
+	return content
+}
+
+// Source of the videos in a ZIP download, either a Mongo cursor or an ordered list such as a playlist
+type videoCursor interface {
+	Next(ctx context.Context) bool
+	Decode(val interface{}) error
+	Err() error
+}
+
+// What a ZIP download is called and the messages its handler has always answered with
+type videosZip struct {
+	Name          string // File name of the archive
+	EmptyMessage  string // Sent when no video ends up in the archive
+	StreamMessage string // Sent when a video can not be copied into the archive
+	Kind          string // Describes the videos in the log, such as "flagged videos"
+}
+
+// Builds an attachment Content-Disposition header. Names come from users, so quotes and
+// non-ASCII characters are escaped or encoded instead of being written into the header as is.
+func attachmentDisposition(filename string) string {
+	if disposition := mime.FormatMediaType("attachment", map[string]string{"filename": filename}); disposition != "" {
+		return disposition
+	}
+	return "attachment"
+}
+
+// Streams every video from the cursor into a ZIP archive, each with an indexed metadata file
+func writeVideosZip(c *gin.Context, cursor videoCursor, storage Storage.Backend, download videosZip) {
 	// Set response headers for ZIP file
 	c.Header("Content-Type", "application/zip")
-	c.Header("Content-Disposition", `attachment; filename="videos_with_metadata.zip"`)
+	c.Header("Content-Disposition", attachmentDisposition(download.Name))
 
 	// Create a ZIP writer
 	zipWriter := zip.NewWriter(c.Writer)
 	defer zipWriter.Close()
 
-	// Initialize an index for file differentiation
 	index := 1
 	videoCount := 0
 
-	// Loop through matching videos and add them to the ZIP
 	for cursor.Next(context.TODO()) {
 		var videoMetadata Schemas.Video
 		if err := cursor.Decode(&videoMetadata); err != nil {
@@ -322,9 +430,8 @@ func GetAllVideosByName(c *gin.Context) {
 			return
 		}
 
-		// Convert video_id to ObjectID
-		objectID, err := primitive.ObjectIDFromHex(videoMetadata.VideoID)
-		if err != nil {
+		// Validate video_id
+		if _, err := primitive.ObjectIDFromHex(videoMetadata.VideoID); err != nil {
 			fmt.Printf("Invalid ObjectID: %v\n", err)
 			continue
 		}
@@ -336,39 +443,26 @@ func GetAllVideosByName(c *gin.Context) {
 			return
 		}
 
-		// Write metadata content
-		metadataContent := fmt.Sprintf(
-			"Video Name: %s\nUploader: %s\nDescription: %s\nTags: %v\nPosted At: %s\nVideo ID: %s\nFlagged Count: %d\n",
-			videoMetadata.VideoName,
-			videoMetadata.Uploader,
-			videoMetadata.Description,
-			videoMetadata.Tags,
-			videoMetadata.PostedAt.Format(time.RFC3339),
-			videoMetadata.VideoID,
-			videoMetadata.Flagged, // Add flagged count
-		)
-
-		_, err = metadataFile.Write([]byte(metadataContent))
+		_, err = metadataFile.Write([]byte(videoMetadataContent(videoMetadata)))
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error writing metadata file"})
 			return
 		}
 
 		// Add the video file itself with an index
-		videoFile, err := zipWriter.Create(fmt.Sprintf("%s_%d.mp4", videoMetadata.VideoName, index))
+		videoFile, err := zipWriter.Create(fmt.Sprintf("%s_%d%s", videoMetadata.VideoName, index, videoExtension(videoMetadata)))
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating video file in ZIP"})
 			return
 		}
 
 		// Stream video content into the ZIP file
-		_, err = bucket.DownloadToStream(objectID, videoFile)
+		err = copyVideoBlob(context.TODO(), storage, videoBlobID(videoMetadata), videoFile)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error streaming video", "error": err.Error()})
+			c.JSON(http.StatusInternalServerError, gin.H{"message": download.StreamMessage, "error": err.Error()})
 			return
 		}
 
-		// Increment counters
 		index++
 		videoCount++
 	}
@@ -379,11 +473,11 @@ func GetAllVideosByName(c *gin.Context) {
 	}
 
 	if videoCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"message": "No videos found with the given name"})
+		c.JSON(http.StatusNotFound, gin.H{"message": download.EmptyMessage})
 		return
 	}
 
-	fmt.Printf("Total videos added to ZIP: %d\n", videoCount)
+	fmt.Printf("Total %s added to ZIP: %d\n", download.Kind, videoCount)
 	c.Status(http.StatusOK)
 }
 
@@ -397,20 +491,18 @@ func DeleteVideoByID(c *gin.Context) {
 		return
 	}
 
-	// Convert video_id to ObjectID
-	objectID, err := primitive.ObjectIDFromHex(videoID)
-	if err != nil {
+	// Validate video_id
+	if _, err := primitive.ObjectIDFromHex(videoID); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid video_id"})
 		return
 	}
 
 	// Connect to MongoDB
-	client := Mongo.GetMongoDB()
 	collection := Mongo.GetCollection("videostore")
 	usersCollection := Mongo.GetCollection("users")
-	bucket, err := gridfs.NewBucket(client.Database("Pametni-Paketnik-baza"))
+	storage, err := Storage.Default()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating GridFS bucket"})
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error opening media storage"})
 		return
 	}
 
@@ -449,6 +541,7 @@ func DeleteVideoByID(c *gin.Context) {
 	}
 
 	// Find and delete video metadata
+	var deletedVideo Schemas.Video
 	result := collection.FindOneAndDelete(context.TODO(), bson.M{"video_id": videoID})
 	if result.Err() != nil {
 		if result.Err() == mongo.ErrNoDocuments {
@@ -458,14 +551,64 @@ func DeleteVideoByID(c *gin.Context) {
 		}
 		return
 	}
+	if err := result.Decode(&deletedVideo); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error decoding video metadata", "error": err.Error()})
+		return
+	}
+
+	// Comments live in their own collection and go together with the video
+	_, err = Mongo.GetCollection("videostore_comments").DeleteMany(context.TODO(), bson.M{"video_id": videoID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error deleting video comments", "error": err.Error()})
+		return
+	}
+
+	_, err = Mongo.GetCollection("videostore_captions").DeleteMany(context.TODO(), bson.M{"video_id": videoID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error deleting caption tracks", "error": err.Error()})
+		return
+	}
+
+	_, err = Mongo.GetCollection("videostore_notes").DeleteMany(context.TODO(), bson.M{"video_id": videoID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error deleting video notes", "error": err.Error()})
+		return
+	}
+
+	_, err = Mongo.GetCollection("videostore_playlists").UpdateMany(context.TODO(), bson.M{"video_ids": videoID}, bson.M{"$pull": bson.M{"video_ids": videoID}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error removing video from playlists", "error": err.Error()})
+		return
+	}
+
+	if err := closeReports(context.TODO(), Schemas.ReportVideo, videoID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error closing reports", "error": err.Error()})
+		return
+	}
+
+	if err := closeAppeals(context.TODO(), videoID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error closing appeals", "error": err.Error()})
+		return
+	}
+
+	// Votes, statistics and watch progress mean nothing without the video
+	for _, statsCollection := range []string{"videostore_votes", "videostore_daily_stats", "videostore_watch_progress", "videostore_watch_reports", "videostore_flags"} {
+		_, err = Mongo.GetCollection(statsCollection).DeleteMany(context.TODO(), bson.M{"video_id": videoID})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error deleting video statistics", "error": err.Error()})
+			return
+		}
+	}
 
-	// Delete video file from GridFS
-	err = bucket.Delete(objectID)
+	// Delete video file from the media storage once no other video shares it
+	err = releaseVideoBlob(context.TODO(), storage, deletedVideo)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error deleting video file from GridFS", "error": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error deleting video file from media storage", "error": err.Error()})
 		return
 	}
 
+	deletePosterVariants(context.TODO(), storage, deletedVideo.Poster)
+
 	// Return success response
 	c.JSON(http.StatusOK, gin.H{"message": "Video deleted successfully"})
 }
@@ -473,6 +616,8 @@ func DeleteVideoByID(c *gin.Context) {
 type VideoFlagRequest struct {
 	VideoID string `json:"video_id"`
 	UserID  string `json:"user_id"`
+	Reason  string `json:"reason"`
+	Comment string `json:"comment"`
 }
 
 func FlagVideo(c *gin.Context) {
@@ -482,165 +627,119 @@ func FlagVideo(c *gin.Context) {
 		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
-	videoID := request.VideoID
-	userID := request.UserID
-
-	fmt.Printf("Received video_id: %s, user_id: %s\n", videoID, userID) // Log incoming parameters
 
-	if videoID == "" || userID == "" {
+	if request.VideoID == "" || request.UserID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "video_id and user_id are required"})
 		return
 	}
 
-	// Convert userID to ObjectId
-	userObjectID, err := primitive.ObjectIDFromHex(userID)
-	fmt.Printf("userObjectID: %s\n", userObjectID)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid user_id format"})
+	flagVideo(c, request)
+}
+
+// Flags a video, also used for video reports. The error or success response is written here.
+func flagVideo(c *gin.Context, request VideoFlagRequest) {
+	videoID := request.VideoID
+	userID := request.UserID
+
+	if err := checkReportDetails(&request.Reason, &request.Comment); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error(), "reasons": Schemas.ReportReasons})
 		return
 	}
 
-	// Connect to MongoDB
-	collection := Mongo.GetCollection("videostore")
-	usersCollection := Mongo.GetCollection("users")
+	video, user, ok := flagTarget(c, videoID, userID)
+	if !ok {
+		return
+	}
 
-	// Verify the user exists in the users collection
-	var user bson.M
-	err = usersCollection.FindOne(context.TODO(), bson.M{"_id": userObjectID}).Decode(&user)
+	flag := Schemas.VideoFlag{
+		ID:        videoID + ":" + userID,
+		VideoId:   videoID,
+		UserID:    userID,
+		Username:  user.Name,
+		Reason:    request.Reason,
+		Comment:   request.Comment,
+		Weight:    flagWeight(user),
+		CreatedAt: time.Now(),
+	}
 
-	if errors.Is(err, mongo.ErrNoDocuments) {
-		if err == mongo.ErrNoDocuments {
-			c.JSON(http.StatusNotFound, gin.H{"message": "Invalid user"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error verifying user", "error": err.Error()})
+	// The flag id is unique per user and video, so a second flag fails to insert
+	flagsCollection := Mongo.GetCollection("videostore_flags")
+	_, err := flagsCollection.InsertOne(context.TODO(), flag)
+	if mongo.IsDuplicateKeyError(err) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "You have already flagged this video"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error flagging the video", "error": err.Error()})
 		return
 	}
 
 	// Atomically check if the user_id is already in the flagged_by array and add it if not
-	updateResult, err := collection.UpdateOne(
+	updateResult, err := Mongo.GetCollection("videostore").UpdateOne(
 		context.TODO(),
 		bson.M{
 			"video_id":   videoID,
 			"flagged_by": bson.M{"$ne": userID}, // Ensure the user is not already in the flagged_by array
 		},
-		bson.M{
-			"$inc":      bson.M{"flagged": 1},         // Increment the flagged count
-			"$addToSet": bson.M{"flagged_by": userID}, // Add userID to the flagged_by array
-		},
+		addFlagUpdate(userID, flag.Weight),
 	)
+	if err != nil || updateResult.MatchedCount == 0 {
+		flagsCollection.DeleteOne(context.TODO(), bson.M{"_id": flag.ID})
+	}
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error flagging the video", "error": err.Error()})
 		return
 	}
 
-	// Check if the user was already in the flagged_by array
+	// Users who flagged before reasons were recorded are only in the flagged_by array
 	if updateResult.MatchedCount == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "You have already flagged this video"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Video flagged successfully"})
+	if err := trackReport(context.TODO(), Schemas.ReportVideo, videoID, video.Uploader, flag.Weight); err != nil {
+		fmt.Printf("Error tracking report on video %s: %v\n", videoID, err)
+	}
+
+	// Flaggers stay anonymous to the uploader
+	notifyUploader(context.TODO(), videoID, Schemas.NotificationVideoFlagged, "", "Your video has been flagged as "+request.Reason)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Video flagged successfully", "flag": flag})
 }
 
+// Downloads the videos hidden by flags, which includes private and course videos, so only moderators may
 func GetFlaggedVideos(c *gin.Context) {
-	client := Mongo.GetMongoDB()
+	if _, ok := moderatorUser(c, c.Query("admin_username")); !ok {
+		return
+	}
+
 	collection := Mongo.GetCollection("videostore")
-	bucket, err := gridfs.NewBucket(client.Database("Pametni-Paketnik-baza"))
+	storage, err := Storage.Default()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating GridFS bucket"})
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error opening media storage"})
 		return
 	}
 
-	// Query videos with flagged count greater than 3
-	cursor, err := collection.Find(context.TODO(), bson.M{"flagged": bson.M{"$gt": 3}})
+	// Query videos whose flags reached the hide threshold
+	filter := hiddenByFlags()
+	filter["removed"] = bson.M{"$ne": true}
+	cursor, err := collection.Find(context.TODO(), filter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error querying video metadata"})
 		return
 	}
 	defer cursor.Close(context.TODO())
 
-	// Set response headers for ZIP file
-	c.Header("Content-Type", "application/zip")
-	c.Header("Content-Disposition", `attachment; filename="flagged_videos.zip"`)
-
-	// Create a ZIP writer
-	zipWriter := zip.NewWriter(c.Writer)
-	defer zipWriter.Close()
-
-	index := 1
-	videoCount := 0
-
-	for cursor.Next(context.TODO()) {
-		var videoMetadata Schemas.Video
-		if err := cursor.Decode(&videoMetadata); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error decoding video metadata"})
-			return
-		}
-
-		// Convert video_id to ObjectID
-		objectID, err := primitive.ObjectIDFromHex(videoMetadata.VideoID)
-		if err != nil {
-			fmt.Printf("Invalid ObjectID: %v\n", err)
-			continue
-		}
-
-		// Add metadata.txt file for this video with an index
-		metadataFile, err := zipWriter.Create(fmt.Sprintf("%s_%d_metadata.txt", videoMetadata.VideoName, index))
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating metadata file"})
-			return
-		}
-
-		metadataContent := fmt.Sprintf(
-			"Video Name: %s\nUploader: %s\nDescription: %s\nTags: %v\nPosted At: %s\nVideo ID: %s\nFlagged Count: %d\n",
-			videoMetadata.VideoName,
-			videoMetadata.Uploader,
-			videoMetadata.Description,
-			videoMetadata.Tags,
-			videoMetadata.PostedAt.Format(time.RFC3339),
-			videoMetadata.VideoID,
-			videoMetadata.Flagged,
-		)
-
-		_, err = metadataFile.Write([]byte(metadataContent))
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error writing metadata file"})
-			return
-		}
-
-		// Add the video file itself with an index
-		videoFile, err := zipWriter.Create(fmt.Sprintf("%s_%d.mp4", videoMetadata.VideoName, index))
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating video file in ZIP"})
-			return
-		}
-
-		_, err = bucket.DownloadToStream(objectID, videoFile)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error streaming video to ZIP", "error": err.Error()})
-			return
-		}
-
-		index++
-		videoCount++
-	}
-
-	if err := cursor.Err(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Cursor error"})
-		return
-	}
-
-	if videoCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"message": "No flagged videos found in the database"})
-		return
-	}
-
-	fmt.Printf("Total flagged videos added to ZIP: %d\n", videoCount)
-	c.Status(http.StatusOK)
+	writeVideosZip(c, cursor, storage, videosZip{
+		Name:          "flagged_videos.zip",
+		EmptyMessage:  "No flagged videos found in the database",
+		StreamMessage: "Error streaming video to ZIP",
+		Kind:          "flagged videos",
+	})
 }
 
+// Clears the flags on a video. It is recorded in the moderation log like a restore decision.
 func ResetFlaggedCounter(c *gin.Context) {
 	// Get video_id and admin_username from query parameters
 	videoID := c.Query("video_id")
@@ -651,46 +750,49 @@ func ResetFlaggedCounter(c *gin.Context) {
 		return
 	}
 
-	// Connect to MongoDB
-	collection := Mongo.GetCollection("videostore")
-	usersCollection := Mongo.GetCollection("users")
-
 	// Verify the user exists and is an admin
-	var user bson.M
-	err := usersCollection.FindOne(context.TODO(), bson.M{"username": adminUsername}).Decode(&user)
+	moderator, ok := moderatorUser(c, adminUsername)
+	if !ok {
+		return
+	}
+
+	var video Schemas.Video
+	err := Mongo.GetCollection("videostore").FindOne(context.TODO(), bson.M{"video_id": videoID}).Decode(&video)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			c.JSON(http.StatusNotFound, gin.H{"message": "Admin user not found"})
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Video not found"})
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving user data", "error": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving video metadata", "error": err.Error()})
 		return
 	}
 
-	// Check if the user is an admin
-	isAdmin, _ := user["admin"].(bool)
-	if !isAdmin {
-		c.JSON(http.StatusForbidden, gin.H{"message": "You are not authorized to reset the flagged counter"})
+	reason := strings.TrimSpace(c.DefaultQuery("reason", "Flags reset"))
+	if _, ok := applyModerationDecision(c, moderator, video, Schemas.ModerationRestore, reason); !ok {
 		return
 	}
 
-	// Reset the flagged counter of the video to 0
-	updateResult, err := collection.UpdateOne(
-		context.TODO(),
-		bson.M{"video_id": videoID},
-		bson.M{"$set": bson.M{"flagged": 0}},
-	)
+	// Return success response
+	c.JSON(http.StatusOK, gin.H{"message": "Flagged counter reset successfully"})
+}
+
+// Lets the uploader of a video know about moderation activity on it
+func notifyUploader(ctx context.Context, videoID string, notificationType string, actor string, message string) {
+	var videoMetadata Schemas.Video
+	err := Mongo.GetCollection("videostore").FindOne(ctx, bson.M{"video_id": videoID}).Decode(&videoMetadata)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error resetting flagged counter", "error": err.Error()})
+		fmt.Printf("Error retrieving video for notification: %v\n", err)
 		return
 	}
 
-	// Check if the video was found and updated
-	if updateResult.MatchedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"message": "Video not found"})
-		return
+	err = createNotification(ctx, Schemas.Notification{
+		Username: videoMetadata.Uploader,
+		Type:     notificationType,
+		Actor:    actor,
+		Message:  fmt.Sprintf("%s: %s", message, videoMetadata.VideoName),
+		VideoId:  videoID,
+	})
+	if err != nil {
+		fmt.Printf("Error notifying uploader %s: %v\n", videoMetadata.Uploader, err)
 	}
-
-	// Return success response
-	c.JSON(http.StatusOK, gin.H{"message": "Flagged counter reset successfully"})
 }
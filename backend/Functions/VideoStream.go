@@ -0,0 +1,73 @@
+package Functions
+
+import (
+	"backend/Mongo"
+	"backend/Schemas"
+	"backend/Storage"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Serves a single video for inline playback with byte-range and conditional request support
+func StreamVideo(c *gin.Context) {
+	videoID := c.Param("id")
+
+	if _, err := primitive.ObjectIDFromHex(videoID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid video_id"})
+		return
+	}
+
+	viewer, ok := videoViewer(c)
+	if !ok {
+		return
+	}
+
+	// Retrieve video metadata excluding flagged videos and ones the viewer may not see
+	filter := visibleVideoFilter(viewer, false)
+	filter["video_id"] = videoID
+
+	var videoMetadata Schemas.Video
+	err := Mongo.GetCollection("videostore").FindOne(c, filter).Decode(&videoMetadata)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Video not found or flagged"})
+		return
+	}
+
+	serveVideoStream(c, videoMetadata)
+}
+
+// Writes the file of a video the caller already checked the viewer may watch
+func serveVideoStream(c *gin.Context, videoMetadata Schemas.Video) {
+	storage, err := Storage.Default()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error opening media storage"})
+		return
+	}
+
+	info, err := storage.Stat(c, videoBlobID(videoMetadata))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Video file not found"})
+		return
+	}
+
+	// Byte ranges are fetched from the storage on demand, so seeking never downloads the whole file
+	reader := Storage.NewReadSeeker(c.Request.Context(), storage, videoBlobID(videoMetadata), info.Size)
+	defer reader.Close()
+
+	// Stored videos never change after upload, so their hash (or id and size) identifies the content
+	if videoMetadata.SHA256 != "" {
+		c.Header("ETag", fmt.Sprintf(`"%s"`, videoMetadata.SHA256))
+		c.Header("X-Content-SHA256", videoMetadata.SHA256)
+	} else {
+		c.Header("ETag", fmt.Sprintf(`"%s-%d"`, videoMetadata.VideoID, info.Size))
+	}
+	c.Header("Content-Type", videoContentType(videoMetadata))
+	c.Header("Content-Disposition", fmt.Sprintf(`inline; filename="%s%s"`, videoMetadata.VideoName, videoExtension(videoMetadata)))
+	c.Header("Cache-Control", "private, max-age=3600")
+
+	// ServeContent handles Range, If-Range, If-None-Match and If-Modified-Since
+	http.ServeContent(c.Writer, c.Request, "", info.ModTime, reader)
+}
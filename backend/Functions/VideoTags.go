@@ -0,0 +1,155 @@
+package Functions
+
+import (
+	"backend/Mongo"
+	"backend/Storage"
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Lowercases tags, collapses whitespace, splits comma separated values and drops duplicates,
+// so the same tag is always stored and queried in the same form
+func normalizeTags(values []string) []string {
+	tags := make([]string, 0)
+	seen := make(map[string]bool)
+
+	for _, value := range values {
+		for _, tag := range strings.Split(value, ",") {
+			tag = strings.ToLower(strings.Join(strings.Fields(tag), " "))
+			if tag == "" || seen[tag] {
+				continue
+			}
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
+
+// Reads the tags of an upload form, the frontend sends them as flags[]
+func uploadTags(c *gin.Context) []string {
+	return normalizeTags(append(c.PostFormArray("flags"), c.PostFormArray("flags[]")...))
+}
+
+// Builds the tag condition of a video query, "all" requires every tag and anything else at least one
+func tagFilter(tags []string, match string) bson.M {
+	if match == "all" {
+		return bson.M{"$all": tags}
+	}
+	return bson.M{"$in": tags}
+}
+
+func GetVideosByTags(c *gin.Context) {
+	tags := normalizeTags(c.QueryArray("flags"))
+	if len(tags) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "flags are required"})
+		return
+	}
+
+	viewer, ok := videoViewer(c)
+	if !ok {
+		return
+	}
+
+	collection := Mongo.GetCollection("videostore")
+	storage, err := Storage.Default()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error opening media storage"})
+		return
+	}
+
+	// Query listed videos carrying the requested tags excluding flagged ones
+	filter := visibleVideoFilter(viewer, true)
+	filter["tags"] = tagFilter(tags, c.DefaultQuery("match", "any"))
+
+	cursor, err := collection.Find(context.TODO(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error querying video metadata"})
+		return
+	}
+	defer cursor.Close(context.TODO())
+
+	writeVideosZip(c, cursor, storage, videosZip{
+		Name:          "videos_by_flags.zip",
+		EmptyMessage:  "No videos found with the given flags",
+		StreamMessage: "Error streaming video to ZIP",
+		Kind:          "videos",
+	})
+}
+
+type TagCount struct {
+	Tag   string `json:"tag" bson:"_id"`
+	Count int    `json:"count" bson:"count"`
+}
+
+// Lists every tag used on visible videos together with the number of videos carrying it
+func GetTags(c *gin.Context) {
+	viewer, ok := videoViewer(c)
+	if !ok {
+		return
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: visibleVideoFilter(viewer, true)}},
+		{{Key: "$unwind", Value: "$tags"}},
+		{{Key: "$group", Value: bson.M{"_id": "$tags", "count": bson.M{"$sum": 1}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+	}
+
+	cursor, err := Mongo.GetCollection("videostore").Aggregate(c, pipeline)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error aggregating tags"})
+		return
+	}
+	defer cursor.Close(c)
+
+	tags := make([]TagCount, 0)
+	if err := cursor.All(c, &tags); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error decoding tags"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tags)
+}
+
+// Rewrites the tags of videos stored before tags were normalized, so they match the lowercase
+// queries again. Returns the number of videos that were changed. Used by cmd/migrate-tags.
+func NormalizeStoredTags(ctx context.Context) (int, error) {
+	collection := Mongo.GetCollection("videostore")
+	cursor, err := collection.Find(ctx, bson.M{"tags.0": bson.M{"$exists": true}}, options.Find().SetProjection(bson.M{"video_id": 1, "tags": 1}))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	updated := 0
+	for cursor.Next(ctx) {
+		var video struct {
+			VideoID string   `bson:"video_id"`
+			Tags    []string `bson:"tags"`
+		}
+		if err := cursor.Decode(&video); err != nil {
+			return updated, err
+		}
+
+		tags := normalizeTags(video.Tags)
+		if reflect.DeepEqual(tags, video.Tags) {
+			continue
+		}
+
+		if _, err := collection.UpdateOne(ctx, bson.M{"video_id": video.VideoID}, bson.M{"$set": bson.M{"tags": tags}}); err != nil {
+			return updated, err
+		}
+		updated++
+	}
+
+	return updated, cursor.Err()
+}
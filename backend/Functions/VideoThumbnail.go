@@ -0,0 +1,238 @@
+package Functions
+
+import (
+	"backend/Config"
+	"backend/Media"
+	"backend/Mongo"
+	"backend/Schemas"
+	"backend/Storage"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var errPosterTooLarge = errors.New("poster image is too large")
+
+// Widths of the stored poster variants
+var thumbnailSizes = map[string]int{
+	"small":  320,
+	"medium": 640,
+	"large":  1280,
+}
+
+const defaultThumbnailSize = "medium"
+
+// Largest poster image that can be uploaded
+func maxPosterSize() int64 {
+	return int64(Config.GetENVInt("POSTER_MAX_SIZE_MB", 10)) * 1024 * 1024
+}
+
+// Reads and decodes an uploaded poster, only JPEG and PNG images are accepted
+func readPosterImage(file *multipart.FileHeader) (image.Image, error) {
+	if file.Size > maxPosterSize() {
+		return nil, errPosterTooLarge
+	}
+
+	stream, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	data, err := io.ReadAll(io.LimitReader(stream, maxPosterSize()+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxPosterSize() {
+		return nil, errPosterTooLarge
+	}
+
+	return Media.DecodeImage(data)
+}
+
+// Writes a poster error response, bad images are the client's fault and anything else is ours
+func respondPosterError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errPosterTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"message": err.Error(), "max_size": maxPosterSize()})
+	case errors.Is(err, Media.ErrUnsupportedImage):
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"message": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error reading poster image"})
+	}
+}
+
+// Stores a JPEG of the poster for every thumbnail size
+func storePosterVariants(ctx context.Context, storage Storage.Backend, name string, img image.Image) (*Schemas.VideoPoster, error) {
+	poster := &Schemas.VideoPoster{Variants: make(map[string]string), UpdatedAt: time.Now()}
+
+	for size, width := range thumbnailSizes {
+		var buffer bytes.Buffer
+		if err := Media.EncodeJPEG(&buffer, Media.Resize(img, width)); err != nil {
+			deletePosterVariants(ctx, storage, poster)
+			return nil, err
+		}
+
+		blobID := Storage.NewID()
+		if _, err := storage.Put(ctx, blobID, fmt.Sprintf("%s_poster_%s.jpg", name, size), &buffer); err != nil {
+			deletePosterVariants(ctx, storage, poster)
+			return nil, err
+		}
+		poster.Variants[size] = blobID
+	}
+
+	return poster, nil
+}
+
+// Removes the stored poster variants, failures are logged since the video itself is unaffected
+func deletePosterVariants(ctx context.Context, storage Storage.Backend, poster *Schemas.VideoPoster) {
+	if poster == nil {
+		return
+	}
+
+	for size, blobID := range poster.Variants {
+		if err := storage.Delete(ctx, blobID); err != nil && !errors.Is(err, Storage.ErrNotFound) {
+			log.Printf("(deletePosterVariants) Error deleting %s poster %s: %v", size, blobID, err)
+		}
+	}
+}
+
+// Replaces the poster of a video, only the uploader and moderators can change it
+func SetVideoPoster(c *gin.Context) {
+	videoID := c.Param("video_id")
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxPosterSize()+1024*1024)
+	file, err := c.FormFile("poster")
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			respondPosterError(c, errPosterTooLarge)
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Error getting poster image"})
+		return
+	}
+
+	videoMetadata, _, ok := authorizeVideoChange(c, videoID, c.PostForm("username"))
+	if !ok {
+		return
+	}
+
+	img, err := readPosterImage(file)
+	if err != nil {
+		respondPosterError(c, err)
+		return
+	}
+
+	storage, err := Storage.Default()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error opening media storage"})
+		return
+	}
+
+	poster, err := storePosterVariants(c, storage, videoMetadata.VideoName, img)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error storing poster image", "error": err.Error()})
+		return
+	}
+
+	_, err = Mongo.GetCollection("videostore").UpdateOne(c, bson.M{"video_id": videoID}, bson.M{"$set": bson.M{"poster": poster}})
+	if err != nil {
+		deletePosterVariants(c, storage, poster)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving poster"})
+		return
+	}
+
+	deletePosterVariants(c, storage, videoMetadata.Poster)
+
+	videoMetadata.Poster = poster
+	c.JSON(http.StatusOK, gin.H{"message": "Poster updated successfully", "thumbnail_url": thumbnailURL(videoMetadata)})
+}
+
+// The poster version in the URL makes clients load a new poster instead of the one they cached
+func thumbnailURL(video Schemas.Video) string {
+	url := "/videostore/thumbnail/" + video.VideoID
+	if video.Poster != nil {
+		url += fmt.Sprintf("?v=%d", video.Poster.UpdatedAt.Unix())
+	}
+	return url
+}
+
+// Serves a poster variant, or a generated placeholder for videos without a poster
+func GetVideoThumbnail(c *gin.Context) {
+	videoID := c.Param("video_id")
+
+	size := c.DefaultQuery("size", defaultThumbnailSize)
+	width, ok := thumbnailSizes[size]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "size must be small, medium or large"})
+		return
+	}
+
+	viewer, ok := videoViewer(c)
+	if !ok {
+		return
+	}
+
+	videoMetadata, err := findVisibleVideo(c, viewer, videoID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Video not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving video metadata"})
+		return
+	}
+
+	// Shared caches may only keep thumbnails of videos anyone can see. Caches revalidate with the
+	// ETag on every use, so a new poster or a change of visibility applies right away.
+	if videoMetadata.Visibility == Schemas.VideoPublic || videoMetadata.Visibility == "" {
+		c.Header("Cache-Control", "public, no-cache")
+	} else {
+		c.Header("Cache-Control", "private, no-cache")
+	}
+	c.Header("Content-Type", "image/jpeg")
+
+	if videoMetadata.Poster == nil || videoMetadata.Poster.Variants[size] == "" {
+		var buffer bytes.Buffer
+		if err := Media.EncodeJPEG(&buffer, Media.Placeholder(videoID, width)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error generating thumbnail"})
+			return
+		}
+
+		c.Header("ETag", fmt.Sprintf(`"placeholder-%s-%s"`, videoID, size))
+		http.ServeContent(c.Writer, c.Request, "", time.Time{}, bytes.NewReader(buffer.Bytes()))
+		return
+	}
+
+	storage, err := Storage.Default()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error opening media storage"})
+		return
+	}
+
+	blobID := videoMetadata.Poster.Variants[size]
+	info, err := storage.Stat(c, blobID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Thumbnail not found"})
+		return
+	}
+
+	reader := Storage.NewReadSeeker(c.Request.Context(), storage, blobID, info.Size)
+	defer reader.Close()
+
+	// A new poster gets new blob ids, so the id identifies the content
+	c.Header("ETag", fmt.Sprintf(`"%s"`, blobID))
+	http.ServeContent(c.Writer, c.Request, "", videoMetadata.Poster.UpdatedAt, reader)
+}
@@ -0,0 +1,139 @@
+package Functions
+
+import (
+	"backend/Config"
+	"backend/Media"
+	"backend/Mongo"
+	"backend/Schemas"
+	"backend/Storage"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var (
+	errUnsupportedVideo = errors.New("file is not a supported MP4, WebM or MKV video")
+	errDisguisedVideo   = errors.New("file extension does not match the video content")
+	errUploaderBanned   = errors.New("banned users can not upload videos")
+)
+
+const (
+	maxVideoTitleLength       = 200
+	maxVideoDescriptionLength = 5000
+	maxVideoTags              = 20
+)
+
+// Checks the editable details of a video, shared by uploads and edits
+func validateVideoDetails(title string, description string, tags []string) error {
+	if strings.TrimSpace(title) == "" {
+		return errors.New("title is required")
+	}
+	if utf8.RuneCountInString(title) > maxVideoTitleLength {
+		return fmt.Errorf("title must be at most %d characters", maxVideoTitleLength)
+	}
+	if utf8.RuneCountInString(description) > maxVideoDescriptionLength {
+		return fmt.Errorf("description must be at most %d characters", maxVideoDescriptionLength)
+	}
+	if len(tags) > maxVideoTags {
+		return fmt.Errorf("at most %d tags are allowed", maxVideoTags)
+	}
+	return nil
+}
+
+// Largest video a user may upload, moderators get a separate and usually larger limit
+func maxVideoSize(isAdmin bool) int64 {
+	if isAdmin {
+		return int64(Config.GetENVInt("VIDEO_MAX_SIZE_ADMIN_MB", 4096)) * 1024 * 1024
+	}
+	return int64(Config.GetENVInt("VIDEO_MAX_SIZE_MB", 1024)) * 1024 * 1024
+}
+
+// Largest upload any role may send, used to cap request bodies before the uploader is known
+func maxVideoSizeAnyRole() int64 {
+	if maxVideoSize(true) > maxVideoSize(false) {
+		return maxVideoSize(true)
+	}
+	return maxVideoSize(false)
+}
+
+// Looks up the uploader and returns the size limit for their role
+func uploadLimitFor(ctx context.Context, username string) (int64, error) {
+	var user Schemas.User
+	err := Mongo.GetCollection("users").FindOne(ctx, bson.M{"username": username}).Decode(&user)
+	if err != nil {
+		return 0, err
+	}
+
+	if user.Banned {
+		return 0, errUploaderBanned
+	}
+
+	return maxVideoSize(user.Admin), nil
+}
+
+// Verifies the container from the first bytes of an upload. The returned reader still
+// yields the complete stream, including the bytes consumed for sniffing.
+func sniffVideo(stream io.Reader, filename string) (Media.Container, io.Reader, error) {
+	header := make([]byte, Media.SniffLength)
+	n, err := io.ReadFull(stream, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return Media.Container{}, nil, err
+	}
+	header = header[:n]
+
+	container, ok := Media.Sniff(header)
+	if !ok {
+		return Media.Container{}, nil, errUnsupportedVideo
+	}
+
+	if Media.ExtensionMismatch(filename, container) {
+		return Media.Container{}, nil, errDisguisedVideo
+	}
+
+	return container, io.MultiReader(bytes.NewReader(header), stream), nil
+}
+
+// Reads the technical details of a stored video. Only MP4 files are parsed, other containers
+// have no details. Files that fail to parse return an error wrapping Media.ErrInvalidMP4.
+func probeVideo(ctx context.Context, storage Storage.Backend, container Media.Container, blob Schemas.VideoBlob) (*Schemas.VideoMedia, error) {
+	if container != Media.MP4 {
+		return nil, nil
+	}
+
+	reader := Storage.NewReadSeeker(ctx, storage, blob.BlobID, blob.Size)
+	defer reader.Close()
+
+	info, err := Media.ParseMP4(reader, blob.Size)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Schemas.VideoMedia{
+		Duration:   info.Duration,
+		Width:      info.Width,
+		Height:     info.Height,
+		VideoCodec: info.VideoCodec,
+		AudioCodec: info.AudioCodec,
+		Bitrate:    info.Bitrate,
+		FastStart:  info.FastStart,
+	}, nil
+}
+
+// File extension used when a video is downloaded
+func videoExtension(videoMetadata Schemas.Video) string {
+	return Media.ExtensionFor(videoMetadata.ContentType)
+}
+
+// Content type served for a video, older videos were stored before detection and are MP4
+func videoContentType(videoMetadata Schemas.Video) string {
+	if videoMetadata.ContentType == "" {
+		return Media.MP4.ContentType
+	}
+	return videoMetadata.ContentType
+}
@@ -0,0 +1,118 @@
+package Functions
+
+import (
+	"backend/Mongo"
+	"backend/Schemas"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Visibility settings of a video in their stored form
+type videoAccess struct {
+	Visibility  string
+	CourseGroup string
+	PublishAt   *time.Time
+}
+
+// Checks the visibility, course group and RFC 3339 publish time of an upload or edit
+func parseVideoAccess(visibility string, courseGroup string, publishAt string) (videoAccess, error) {
+	access := videoAccess{Visibility: strings.ToLower(strings.TrimSpace(visibility))}
+	if access.Visibility == "" {
+		access.Visibility = Schemas.VideoPublic
+	}
+
+	valid := false
+	for _, known := range Schemas.VideoVisibilities {
+		if access.Visibility == known {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return videoAccess{}, errors.New("visibility must be one of " + strings.Join(Schemas.VideoVisibilities, ", "))
+	}
+
+	// Course groups are compared the same way as tags
+	if access.Visibility == Schemas.VideoRestricted {
+		groups := normalizeTags([]string{courseGroup})
+		if len(groups) != 1 {
+			return videoAccess{}, errors.New("restricted videos need exactly one course_group")
+		}
+		access.CourseGroup = groups[0]
+	}
+
+	if strings.TrimSpace(publishAt) != "" {
+		publishTime, err := time.Parse(time.RFC3339, strings.TrimSpace(publishAt))
+		if err != nil {
+			return videoAccess{}, errors.New("publish_at must be an RFC 3339 time")
+		}
+		access.PublishAt = &publishTime
+	}
+
+	return access, nil
+}
+
+// Identifies who is asking for videos from the optional user_id and username query parameters.
+// Anonymous requests get a nil viewer, when ok is false the error response is already written.
+func videoViewer(c *gin.Context) (*Schemas.User, bool) {
+	userID := c.Query("user_id")
+	username := c.Query("username")
+	if userID == "" && username == "" {
+		return nil, true
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil || username == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "user_id and username must be given together"})
+		return nil, false
+	}
+
+	var user Schemas.User
+	err = Mongo.GetCollection("users").FindOne(c, bson.M{"_id": userObjectID, "username": username}).Decode(&user)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid user"})
+		return nil, false
+	}
+
+	return &user, true
+}
+
+// Builds the query condition for videos the viewer may see. Listings only show public videos,
+// while a direct link also opens unlisted ones. Uploaders always see their own videos and
+// moderators see everything that is not hidden by flags or removed.
+func visibleVideoFilter(viewer *Schemas.User, listed bool) bson.M {
+	filter := bson.M{"$nor": bson.A{hiddenByFlags()}, "removed": bson.M{"$ne": true}}
+	if viewer != nil && viewer.Admin {
+		return filter
+	}
+
+	// Missing publish times count as already published
+	published := bson.M{"$not": bson.M{"$gt": time.Now()}}
+
+	// Videos from before visibility existed have no field and are public
+	visibilities := bson.A{Schemas.VideoPublic, nil}
+	if !listed {
+		visibilities = append(visibilities, Schemas.VideoUnlisted)
+	}
+
+	access := bson.A{bson.M{"visibility": bson.M{"$in": visibilities}, "publish_at": published}}
+	if viewer != nil {
+		access = append(access, bson.M{"uploader_username": viewer.Name})
+		if len(viewer.CourseGroups) > 0 {
+			access = append(access, bson.M{
+				"visibility":   Schemas.VideoRestricted,
+				"course_group": bson.M{"$in": viewer.CourseGroups},
+				"publish_at":   published,
+			})
+		}
+	}
+
+	filter["$or"] = access
+	return filter
+}
@@ -0,0 +1,346 @@
+package Functions
+
+import (
+	"backend/Mongo"
+	"backend/Schemas"
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Share of a video that has to be watched before it counts as finished
+const completedWatchShare = 0.95
+
+// A history entry together with the video it belongs to
+type WatchHistoryItem struct {
+	Schemas.WatchProgress
+	Video VideoListItem `json:"video"`
+}
+
+// Watch history is private, so only verified viewers can read or change their own.
+// When ok is false the error response is already written.
+func historyViewer(c *gin.Context) (*Schemas.User, bool) {
+	viewer, ok := videoViewer(c)
+	if !ok {
+		return nil, false
+	}
+	if viewer == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "user_id and username are required"})
+		return nil, false
+	}
+	return viewer, true
+}
+
+// Position to resume from, finished videos start again from the beginning
+func resumePosition(progress Schemas.WatchProgress) float64 {
+	if progress.Completed {
+		return 0
+	}
+	return progress.Position
+}
+
+// Sets the resume position of listed videos the viewer has started watching
+func attachResumePositions(ctx context.Context, viewer *Schemas.User, items []VideoListItem) error {
+	if viewer == nil || len(items) == 0 {
+		return nil
+	}
+
+	videoIDs := make([]string, 0, len(items))
+	for _, item := range items {
+		videoIDs = append(videoIDs, item.VideoID)
+	}
+
+	cursor, err := Mongo.GetCollection("videostore_watch_progress").Find(ctx, bson.M{"username": viewer.Name, "video_id": bson.M{"$in": videoIDs}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	positions := make(map[string]float64)
+	for cursor.Next(ctx) {
+		var progress Schemas.WatchProgress
+		if err := cursor.Decode(&progress); err != nil {
+			return err
+		}
+		positions[progress.VideoId] = resumePosition(progress)
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	for i := range items {
+		if position, found := positions[items[i].VideoID]; found {
+			items[i].ResumePosition = &position
+		}
+	}
+
+	return nil
+}
+
+// Joins history entries with the videos the viewer may still watch, keeping the entry order.
+// Entries of deleted or hidden videos are left out.
+func watchHistoryItems(ctx context.Context, viewer *Schemas.User, entries []Schemas.WatchProgress) ([]WatchHistoryItem, error) {
+	items := make([]WatchHistoryItem, 0, len(entries))
+	if len(entries) == 0 {
+		return items, nil
+	}
+
+	videoIDs := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		videoIDs = append(videoIDs, entry.VideoId)
+	}
+
+	filter := visibleVideoFilter(viewer, false)
+	filter["video_id"] = bson.M{"$in": videoIDs}
+
+	cursor, err := Mongo.GetCollection("videostore").Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	videos := make(map[string]Schemas.Video)
+	for cursor.Next(ctx) {
+		var video Schemas.Video
+		if err := cursor.Decode(&video); err != nil {
+			return nil, err
+		}
+		videos[video.VideoID] = video
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		video, found := videos[entry.VideoId]
+		if !found {
+			continue
+		}
+		item := WatchHistoryItem{WatchProgress: entry, Video: newVideoListItem(video)}
+		position := resumePosition(entry)
+		item.Video.ResumePosition = &position
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+type WatchProgressRequest struct {
+	Position float64 `json:"position"`
+	Duration float64 `json:"duration"` // Used when the uploaded file had no readable duration
+}
+
+// Saves how far the viewer got in a video, players report it periodically and when playback stops
+func SaveWatchProgress(c *gin.Context) {
+	var request WatchProgressRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request"})
+		return
+	}
+
+	video, viewer, ok := playbackVideo(c)
+	if !ok {
+		return
+	}
+	if viewer == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "user_id and username are required"})
+		return
+	}
+
+	if viewer.HistoryPaused {
+		c.JSON(http.StatusOK, gin.H{"message": "Watch history is paused", "recorded": false})
+		return
+	}
+
+	if err := checkVideoTime(video, request.Position); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	duration := request.Duration
+	if video.Media != nil && video.Media.Duration > 0 {
+		duration = video.Media.Duration
+	}
+	if duration < request.Position {
+		duration = 0
+	}
+
+	progress := Schemas.WatchProgress{
+		ID:        video.VideoID + ":" + viewer.Name,
+		VideoId:   video.VideoID,
+		Username:  viewer.Name,
+		Position:  request.Position,
+		Duration:  duration,
+		Completed: duration > 0 && request.Position >= duration*completedWatchShare,
+		UpdatedAt: time.Now(),
+	}
+
+	_, err := Mongo.GetCollection("videostore_watch_progress").ReplaceOne(c,
+		bson.M{"_id": progress.ID},
+		progress,
+		options.Replace().SetUpsert(true),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving watch progress"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Watch progress saved", "recorded": true, "progress": progress})
+}
+
+// Returns where the viewer left off in a video, zero when they have not started it
+func GetWatchProgress(c *gin.Context) {
+	video, viewer, ok := playbackVideo(c)
+	if !ok {
+		return
+	}
+	if viewer == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "user_id and username are required"})
+		return
+	}
+
+	var progress Schemas.WatchProgress
+	err := Mongo.GetCollection("videostore_watch_progress").FindOne(c, bson.M{"_id": video.VideoID + ":" + viewer.Name}).Decode(&progress)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving watch progress"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"video_id": video.VideoID, "resume_position": resumePosition(progress), "progress": progress})
+}
+
+// Lists videos the viewer started but did not finish, most recently watched first
+func GetContinueWatching(c *gin.Context) {
+	viewer, ok := historyViewer(c)
+	if !ok {
+		return
+	}
+
+	_, limit := getPagination(c, "page", "limit", 10)
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "updated_at", Value: -1}}).
+		SetLimit(int64(limit))
+
+	filter := bson.M{"username": viewer.Name, "completed": false, "position": bson.M{"$gt": 0}}
+	cursor, err := Mongo.GetCollection("videostore_watch_progress").Find(c, filter, findOptions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving watch history"})
+		return
+	}
+	defer cursor.Close(c)
+
+	entries := make([]Schemas.WatchProgress, 0)
+	if err := cursor.All(c, &entries); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error decoding watch history"})
+		return
+	}
+
+	items, err := watchHistoryItems(c, viewer, entries)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving videos"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"videos": items})
+}
+
+// Lists everything the viewer has watched, most recent first
+func GetWatchHistory(c *gin.Context) {
+	viewer, ok := historyViewer(c)
+	if !ok {
+		return
+	}
+
+	collection := Mongo.GetCollection("videostore_watch_progress")
+	filter := bson.M{"username": viewer.Name}
+
+	total, err := collection.CountDocuments(c, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error counting watch history"})
+		return
+	}
+
+	page, limit := getPagination(c, "page", "limit", 20)
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "updated_at", Value: -1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit))
+
+	cursor, err := collection.Find(c, filter, findOptions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving watch history"})
+		return
+	}
+	defer cursor.Close(c)
+
+	entries := make([]Schemas.WatchProgress, 0)
+	if err := cursor.All(c, &entries); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error decoding watch history"})
+		return
+	}
+
+	items, err := watchHistoryItems(c, viewer, entries)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving videos"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"history": items,
+		"paused":  viewer.HistoryPaused,
+		"total":   total,
+		"page":    page,
+		"limit":   limit,
+	})
+}
+
+// Removes one video from the viewer's history, or the whole history when no video_id is given
+func ClearWatchHistory(c *gin.Context) {
+	viewer, ok := historyViewer(c)
+	if !ok {
+		return
+	}
+
+	filter := bson.M{"username": viewer.Name}
+	if videoID := c.Query("video_id"); videoID != "" {
+		filter["video_id"] = videoID
+	}
+
+	result, err := Mongo.GetCollection("videostore_watch_progress").DeleteMany(c, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error clearing watch history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Watch history cleared", "deleted": result.DeletedCount})
+}
+
+// Pauses or resumes recording of watch progress, the existing history is kept either way
+func SetWatchHistoryPaused(c *gin.Context) {
+	var request struct {
+		Paused *bool `json:"paused"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil || request.Paused == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "paused is required"})
+		return
+	}
+
+	viewer, ok := historyViewer(c)
+	if !ok {
+		return
+	}
+
+	_, err := Mongo.GetCollection("users").UpdateOne(c, bson.M{"_id": viewer.ID}, bson.M{"$set": bson.M{"history_paused": *request.Paused}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating watch history settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Watch history settings updated", "paused": *request.Paused})
+}
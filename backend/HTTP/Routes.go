@@ -11,22 +11,97 @@ func Router(router *gin.Engine) {
 	router.POST("/login", Functions.Login)
 	router.GET("/profile", Functions.GetProfile)
 	router.POST("/changePassword", Functions.ChangePassword)
+	router.POST("/block", Functions.BlockUser)
+	router.POST("/unblock", Functions.UnblockUser)
+	router.PUT("/course-groups", Functions.SetCourseGroups)
+	router.PUT("/flag-reputation", Functions.SetFlagReputation)
 
 	router.GET("/post", Functions.GetPost)
 	router.GET("/posts", Functions.GetAllPosts)
 	router.POST("/post", Functions.CreatePost)
 	router.DELETE("/post", Functions.DeletePost)
+	router.POST("/post/accept", Functions.AcceptAnswer)
 
 	router.POST("/comment", Functions.CreateComment)
+	router.PUT("/comment", Functions.EditComment)
 	router.DELETE("/comment", Functions.DeleteComment)
 
+	router.GET("/notifications", Functions.GetNotifications)
+	router.GET("/notifications/unread-count", Functions.GetUnreadNotificationCount)
+	router.POST("/notifications/read", Functions.MarkNotificationRead)
+	router.POST("/notifications/read-all", Functions.MarkAllNotificationsRead)
+	router.GET("/notifications/preferences", Functions.GetNotificationPreferences)
+	router.PUT("/notifications/preferences", Functions.UpdateNotificationPreferences)
+
+	router.GET("/events", Functions.StreamEvents)
+
+	router.GET("/history", Functions.GetWatchHistory)
+	router.GET("/history/continue", Functions.GetContinueWatching)
+	router.DELETE("/history", Functions.ClearWatchHistory)
+	router.PUT("/history/paused", Functions.SetWatchHistoryPaused)
+
+	router.GET("/playlists", Functions.ListPlaylists)
+	router.POST("/playlists", Functions.CreatePlaylist)
+	router.GET("/playlists/:playlist_id", Functions.GetPlaylist)
+	router.PATCH("/playlists/:playlist_id", Functions.EditPlaylist)
+	router.DELETE("/playlists/:playlist_id", Functions.DeletePlaylist)
+	router.POST("/playlists/:playlist_id/videos", Functions.AddPlaylistVideo)
+	router.DELETE("/playlists/:playlist_id/videos/:video_id", Functions.RemovePlaylistVideo)
+	router.PUT("/playlists/:playlist_id/order", Functions.ReorderPlaylist)
+	router.GET("/playlists/:playlist_id/next", Functions.StreamNextPlaylistVideo)
+	router.HEAD("/playlists/:playlist_id/next", Functions.StreamNextPlaylistVideo)
+	router.GET("/playlists/:playlist_id/zip", Functions.GetPlaylistZip)
+
 	router.POST("/videostore/upload", Functions.UploadVideo)
+	router.OPTIONS("/videostore/uploads", Functions.GetUploadOptions)
+	router.POST("/videostore/uploads", Functions.CreateUpload)
+	router.HEAD("/videostore/uploads/:upload_id", Functions.GetUploadOffset)
+	router.PATCH("/videostore/uploads/:upload_id", Functions.PatchUpload)
+	router.DELETE("/videostore/uploads/:upload_id", Functions.DeleteUpload)
 	router.GET("/videostore/video:id", Functions.GetVideo)
+	router.GET("/videostore/stream/:id", Functions.StreamVideo)
+	router.HEAD("/videostore/stream/:id", Functions.StreamVideo)
 	router.GET("/videostore/all", Functions.GetAllVideos)
+	router.GET("/videostore/list", Functions.ListVideos)
 	router.GET("/videostore/videos/name", Functions.GetAllVideosByName)
+	router.GET("/videostore/flags", Functions.GetVideosByTags)
+	router.GET("/videostore/tags", Functions.GetTags)
+	router.PATCH("/videostore/video:video_id", Functions.EditVideo)
+	router.GET("/videostore/edits/:video_id", Functions.GetVideoEditHistory)
 	router.DELETE("/videostore/video:video_id", Functions.DeleteVideoByID)
+	router.PUT("/videostore/poster/:video_id", Functions.SetVideoPoster)
+	router.GET("/videostore/thumbnail/:video_id", Functions.GetVideoThumbnail)
+	router.GET("/videostore/captions/:video_id", Functions.GetCaptionTracks)
+	router.GET("/videostore/captions/:video_id/:language", Functions.GetCaptionTrack)
+	router.PUT("/videostore/captions/:video_id/:language", Functions.UploadCaptionTrack)
+	router.DELETE("/videostore/captions/:video_id/:language", Functions.DeleteCaptionTrack)
+	router.PUT("/videostore/chapters/:video_id", Functions.SetVideoChapters)
+	router.GET("/videostore/notes/:video_id", Functions.GetVideoNotes)
+	router.POST("/videostore/notes", Functions.CreateVideoNote)
+	router.DELETE("/videostore/notes", Functions.DeleteVideoNote)
+	router.POST("/videostore/view/:video_id", Functions.RecordVideoView)
+	router.POST("/videostore/watch/:video_id", Functions.ReportVideoWatch)
+	router.GET("/videostore/progress/:video_id", Functions.GetWatchProgress)
+	router.PUT("/videostore/progress/:video_id", Functions.SaveWatchProgress)
+	router.POST("/videostore/vote/:video_id", Functions.VoteVideo)
+	router.GET("/videostore/analytics/:video_id", Functions.GetVideoAnalytics)
+	router.GET("/videostore/comments", Functions.GetVideoComments)
+	router.POST("/videostore/comment", Functions.CreateVideoComment)
+	router.DELETE("/videostore/comment", Functions.DeleteVideoComment)
 	router.POST("/videostore/flag", Functions.FlagVideo)
+	router.DELETE("/videostore/flag", Functions.RetractVideoFlag)
+	router.GET("/videostore/flag/:video_id", Functions.GetVideoFlags)
 	router.GET("/videostore/flagged", Functions.GetFlaggedVideos)
 	router.POST("/videostore/reset-flagged", Functions.ResetFlaggedCounter)
 
+	router.GET("/moderation/queue", Functions.GetModerationQueue)
+	router.POST("/moderation/decisions", Functions.DecideModeration)
+	router.GET("/moderation/log", Functions.GetModerationLog)
+	router.POST("/moderation/appeals", Functions.CreateAppeal)
+	router.GET("/moderation/inbox", Functions.GetModerationInbox)
+	router.POST("/moderation/reports", Functions.DecideReport)
+
+	router.POST("/reports", Functions.CreateReport)
+	router.DELETE("/reports", Functions.RetractReport)
+
 }
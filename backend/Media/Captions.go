@@ -0,0 +1,188 @@
+package Media
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Returned, wrapped with the offending line, for caption files that cannot be parsed
+var ErrInvalidCaptions = errors.New("invalid caption file")
+
+// WebVTT timestamps may leave out the hours, SRT uses a comma before the milliseconds
+var timestampPattern = regexp.MustCompile(`^(?:(\d+):)?([0-5]\d):([0-5]\d)[.,](\d{3})$`)
+
+type Cue struct {
+	ID       string
+	Start    time.Duration
+	End      time.Duration
+	Settings string // WebVTT cue settings such as position or align
+	Text     string
+}
+
+// A parsed caption track. Style and region blocks of WebVTT files are kept as they are.
+type Captions struct {
+	Blocks []string
+	Cues   []Cue
+}
+
+// Parses a WebVTT or SRT file, files that do not start with the WEBVTT signature are read as SRT.
+// Every cue must end after it starts and cues must be ordered by their start time.
+func ParseCaptions(data []byte) (Captions, error) {
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	lines := strings.Split(text, "\n")
+
+	captions := Captions{}
+	index := 0
+
+	isWebVTT := strings.HasPrefix(lines[0], "WEBVTT")
+	if isWebVTT {
+		if len(lines[0]) > 6 && lines[0][6] != ' ' && lines[0][6] != '\t' {
+			return Captions{}, fmt.Errorf("%w: line 1: malformed WEBVTT signature", ErrInvalidCaptions)
+		}
+		// The header runs until the first blank line
+		for index < len(lines) && strings.TrimSpace(lines[index]) != "" {
+			index++
+		}
+	}
+
+	for index < len(lines) {
+		if strings.TrimSpace(lines[index]) == "" {
+			index++
+			continue
+		}
+
+		start := index
+		for index < len(lines) && strings.TrimSpace(lines[index]) != "" {
+			index++
+		}
+		block := lines[start:index]
+
+		if isWebVTT && (strings.HasPrefix(block[0], "NOTE") || strings.HasPrefix(block[0], "STYLE") || strings.HasPrefix(block[0], "REGION")) {
+			if !strings.HasPrefix(block[0], "NOTE") {
+				if len(captions.Cues) > 0 {
+					return Captions{}, fmt.Errorf("%w: line %d: %s blocks must come before the first cue", ErrInvalidCaptions, start+1, strings.Fields(block[0])[0])
+				}
+				captions.Blocks = append(captions.Blocks, strings.Join(block, "\n"))
+			}
+			continue
+		}
+
+		cue, err := parseCue(block, start+1)
+		if err != nil {
+			return Captions{}, err
+		}
+
+		if count := len(captions.Cues); count > 0 && cue.Start < captions.Cues[count-1].Start {
+			return Captions{}, fmt.Errorf("%w: line %d: cue starts before the previous cue", ErrInvalidCaptions, start+1)
+		}
+		captions.Cues = append(captions.Cues, cue)
+	}
+
+	if len(captions.Cues) == 0 {
+		return Captions{}, fmt.Errorf("%w: no cues found", ErrInvalidCaptions)
+	}
+
+	return captions, nil
+}
+
+// Parses one cue block, which is an optional identifier line, the timing line and the cue text
+func parseCue(block []string, lineNumber int) (Cue, error) {
+	cue := Cue{}
+	timingIndex := 0
+	if !strings.Contains(block[0], "-->") {
+		cue.ID = strings.TrimSpace(block[0])
+		timingIndex = 1
+	}
+
+	if timingIndex >= len(block) || !strings.Contains(block[timingIndex], "-->") {
+		return Cue{}, fmt.Errorf("%w: line %d: missing cue timing", ErrInvalidCaptions, lineNumber)
+	}
+	lineNumber += timingIndex
+
+	parts := strings.SplitN(block[timingIndex], "-->", 2)
+	endFields := strings.Fields(parts[1])
+	if len(endFields) == 0 {
+		return Cue{}, fmt.Errorf("%w: line %d: missing cue end time", ErrInvalidCaptions, lineNumber)
+	}
+
+	var err error
+	if cue.Start, err = parseTimestamp(strings.TrimSpace(parts[0])); err != nil {
+		return Cue{}, fmt.Errorf("%w: line %d: %v", ErrInvalidCaptions, lineNumber, err)
+	}
+	if cue.End, err = parseTimestamp(endFields[0]); err != nil {
+		return Cue{}, fmt.Errorf("%w: line %d: %v", ErrInvalidCaptions, lineNumber, err)
+	}
+	if cue.End <= cue.Start {
+		return Cue{}, fmt.Errorf("%w: line %d: cue must end after it starts", ErrInvalidCaptions, lineNumber)
+	}
+	cue.Settings = strings.Join(endFields[1:], " ")
+
+	// An arrow inside the text would be read as a timing line
+	text := strings.Join(block[timingIndex+1:], "\n")
+	cue.Text = strings.ReplaceAll(text, "-->", "--&gt;")
+
+	return cue, nil
+}
+
+func parseTimestamp(value string) (time.Duration, error) {
+	match := timestampPattern.FindStringSubmatch(value)
+	if match == nil {
+		return 0, fmt.Errorf("malformed timestamp %q", value)
+	}
+
+	hours := 0
+	if match[1] != "" {
+		hours, _ = strconv.Atoi(match[1])
+	}
+	minutes, _ := strconv.Atoi(match[2])
+	seconds, _ := strconv.Atoi(match[3])
+	milliseconds, _ := strconv.Atoi(match[4])
+
+	return time.Duration(hours)*time.Hour +
+		time.Duration(minutes)*time.Minute +
+		time.Duration(seconds)*time.Second +
+		time.Duration(milliseconds)*time.Millisecond, nil
+}
+
+func formatTimestamp(value time.Duration) string {
+	milliseconds := value.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d",
+		milliseconds/3600000,
+		milliseconds/60000%60,
+		milliseconds/1000%60,
+		milliseconds%1000,
+	)
+}
+
+// Writes the captions as a WebVTT file
+func (captions Captions) WebVTT() string {
+	var builder strings.Builder
+	builder.WriteString("WEBVTT\n")
+
+	for _, block := range captions.Blocks {
+		builder.WriteString("\n" + block + "\n")
+	}
+
+	for _, cue := range captions.Cues {
+		builder.WriteString("\n")
+		if cue.ID != "" {
+			builder.WriteString(cue.ID + "\n")
+		}
+		builder.WriteString(formatTimestamp(cue.Start) + " --> " + formatTimestamp(cue.End))
+		if cue.Settings != "" {
+			builder.WriteString(" " + cue.Settings)
+		}
+		builder.WriteString("\n")
+		if cue.Text != "" {
+			builder.WriteString(cue.Text + "\n")
+		}
+	}
+
+	return builder.String()
+}
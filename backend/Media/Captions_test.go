@@ -0,0 +1,170 @@
+package Media
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func seconds(value float64) time.Duration {
+	return time.Duration(value * float64(time.Second))
+}
+
+func TestParseCaptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []Cue
+		blocks  int
+		wantErr string // Part of the error message, empty when the file is valid
+	}{
+		{
+			name:  "srt",
+			input: "1\n00:00:01,000 --> 00:00:02,500\nHello\n\n2\n00:00:03,000 --> 00:00:04,000\nTwo\nlines\n",
+			want: []Cue{
+				{ID: "1", Start: seconds(1), End: seconds(2.5), Text: "Hello"},
+				{ID: "2", Start: seconds(3), End: seconds(4), Text: "Two\nlines"},
+			},
+		},
+		{
+			name:  "srt with byte order mark and windows line endings",
+			input: "\ufeff1\r\n00:00:01,000 --> 00:00:02,000\r\nHi\r\n",
+			want:  []Cue{{ID: "1", Start: seconds(1), End: seconds(2), Text: "Hi"}},
+		},
+		{
+			name:   "webvtt with header, style, note and settings",
+			input:  "WEBVTT - title\nKind: captions\n\nSTYLE\n::cue { color: red }\n\nNOTE a comment\n\n00:01.000 --> 00:02.000 align:start line:0\nShort timestamps\n\nintro\n01:00:00.000 --> 01:00:01.250\nWith hours\n",
+			blocks: 1,
+			want: []Cue{
+				{Start: seconds(1), End: seconds(2), Settings: "align:start line:0", Text: "Short timestamps"},
+				{ID: "intro", Start: time.Hour, End: time.Hour + seconds(1.25), Text: "With hours"},
+			},
+		},
+		{
+			name:  "overlapping cues in start order",
+			input: "WEBVTT\n\n00:01.000 --> 00:05.000\nA\n\n00:02.000 --> 00:03.000\nB\n",
+			want: []Cue{
+				{Start: seconds(1), End: seconds(5), Text: "A"},
+				{Start: seconds(2), End: seconds(3), Text: "B"},
+			},
+		},
+		{
+			name:  "arrow in the text",
+			input: "WEBVTT\n\n00:01.000 --> 00:02.000\na --> b\n",
+			want:  []Cue{{Start: seconds(1), End: seconds(2), Text: "a --&gt; b"}},
+		},
+		{
+			name:    "out of order cues",
+			input:   "WEBVTT\n\n00:05.000 --> 00:06.000\nLater\n\n00:01.000 --> 00:02.000\nEarlier\n",
+			wantErr: "line 6: cue starts before the previous cue",
+		},
+		{
+			name:    "cue ending before it starts",
+			input:   "1\n00:00:02,000 --> 00:00:01,000\nBackwards\n",
+			wantErr: "line 2: cue must end after it starts",
+		},
+		{
+			name:    "malformed timestamp",
+			input:   "1\n00:00:01 --> 00:00:02,000\nNo milliseconds\n",
+			wantErr: "malformed timestamp",
+		},
+		{
+			name:    "missing timing",
+			input:   "1\nJust text\n",
+			wantErr: "line 1: missing cue timing",
+		},
+		{
+			name:    "missing end time",
+			input:   "WEBVTT\n\n00:01.000 -->\nText\n",
+			wantErr: "missing cue end time",
+		},
+		{
+			name:    "style after the first cue",
+			input:   "WEBVTT\n\n00:01.000 --> 00:02.000\nText\n\nSTYLE\n::cue { color: red }\n",
+			wantErr: "STYLE blocks must come before the first cue",
+		},
+		{
+			name:    "malformed signature",
+			input:   "WEBVTTX\n\n00:01.000 --> 00:02.000\nText\n",
+			wantErr: "malformed WEBVTT signature",
+		},
+		{
+			name:    "no cues",
+			input:   "WEBVTT\n\nNOTE nothing here\n",
+			wantErr: "no cues found",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			captions, err := ParseCaptions([]byte(test.input))
+			if test.wantErr != "" {
+				if !errors.Is(err, ErrInvalidCaptions) || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("ParseCaptions() error = %v, want one containing %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseCaptions() error = %v", err)
+			}
+			if !reflect.DeepEqual(captions.Cues, test.want) {
+				t.Errorf("cues = %+v, want %+v", captions.Cues, test.want)
+			}
+			if len(captions.Blocks) != test.blocks {
+				t.Errorf("blocks = %q, want %d", captions.Blocks, test.blocks)
+			}
+		})
+	}
+}
+
+func TestCaptionsSRTToWebVTT(t *testing.T) {
+	tests := []struct {
+		name string
+		srt  string
+		want string
+	}{
+		{
+			name: "numbered cues",
+			srt:  "1\n00:00:01,000 --> 00:00:02,500\nHello\n\n2\n00:01:03,040 --> 00:01:04,000\nTwo\nlines\n",
+			want: "WEBVTT\n\n1\n00:00:01.000 --> 00:00:02.500\nHello\n\n2\n00:01:03.040 --> 00:01:04.000\nTwo\nlines\n",
+		},
+		{
+			name: "cue without id past an hour",
+			srt:  "01:02:03,004 --> 01:02:05,000\n<i>Styled</i>\n",
+			want: "WEBVTT\n\n01:02:03.004 --> 01:02:05.000\n<i>Styled</i>\n",
+		},
+		{
+			name: "windows line endings and blank lines between cues",
+			srt:  "1\r\n00:00:00,500 --> 00:00:01,000\r\nA\r\n\r\n\r\n2\r\n00:00:01,000 --> 00:00:02,000\r\nB\r\n",
+			want: "WEBVTT\n\n1\n00:00:00.500 --> 00:00:01.000\nA\n\n2\n00:00:01.000 --> 00:00:02.000\nB\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			captions, err := ParseCaptions([]byte(test.srt))
+			if err != nil {
+				t.Fatalf("ParseCaptions(srt) error = %v", err)
+			}
+
+			vtt := captions.WebVTT()
+			if vtt != test.want {
+				t.Errorf("WebVTT() = %q, want %q", vtt, test.want)
+			}
+
+			// The converted file reads back to the same cues
+			reparsed, err := ParseCaptions([]byte(vtt))
+			if err != nil {
+				t.Fatalf("ParseCaptions(vtt) error = %v", err)
+			}
+			if !reflect.DeepEqual(reparsed.Cues, captions.Cues) {
+				t.Errorf("round trip cues = %+v, want %+v", reparsed.Cues, captions.Cues)
+			}
+			if reparsed.WebVTT() != vtt {
+				t.Errorf("second conversion differs: %q", reparsed.WebVTT())
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package Media
+
+import (
+	"bytes"
+	"errors"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+
+	_ "image/png"
+)
+
+var ErrUnsupportedImage = errors.New("image is not a supported JPEG or PNG file")
+
+// Largest decoded image in pixels, keeps tiny files that expand to huge bitmaps out of memory
+const maxImagePixels = 50 * 1000 * 1000
+
+// Decodes a JPEG or PNG image after checking its dimensions, the format is detected from the content
+func DecodeImage(data []byte) (image.Image, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || (format != "jpeg" && format != "png") {
+		return nil, ErrUnsupportedImage
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxImagePixels {
+		return nil, ErrUnsupportedImage
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+
+	return img, nil
+}
+
+// Scales an image down to the given width keeping its aspect ratio. Every output pixel is the
+// average of the source pixels it covers, which avoids the aliasing of nearest neighbour scaling.
+// Images that are already narrow enough are returned as they are.
+func Resize(src image.Image, width int) image.Image {
+	bounds := src.Bounds()
+	if width <= 0 || bounds.Dx() <= width {
+		return src
+	}
+
+	height := bounds.Dy() * width / bounds.Dx()
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := bounds.Min.Y + (y+1)*bounds.Dy()/height
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := bounds.Min.X + (x+1)*bounds.Dx()/width
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, a, count uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					r += uint64(pr)
+					g += uint64(pg)
+					b += uint64(pb)
+					a += uint64(pa)
+					count++
+				}
+			}
+
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r / count),
+				G: uint16(g / count),
+				B: uint16(b / count),
+				A: uint16(a / count),
+			})
+		}
+	}
+
+	return dst
+}
+
+// Encodes an image as a JPEG, transparent areas end up black
+func EncodeJPEG(w io.Writer, img image.Image) error {
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: 85})
+}
+
+// Draws a 16:9 placeholder in a colour derived from seed with a play symbol in the middle,
+// so every video without a poster still gets a stable, recognisable image
+func Placeholder(seed string, width int) image.Image {
+	height := width * 9 / 16
+	if height < 1 {
+		height = 1
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(seed))
+	sum := hash.Sum32()
+	background := color.RGBA{R: 40 + uint8(sum)%120, G: 40 + uint8(sum>>8)%120, B: 40 + uint8(sum>>16)%120, A: 255}
+	foreground := color.RGBA{R: 235, G: 235, B: 235, A: 255}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	size := height / 3
+	left := (width - size) / 2
+	top := (height - size) / 2
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, background)
+
+			// Triangle pointing right, narrowing towards the middle row
+			dx := x - left
+			dy := y - top
+			if dx >= 0 && dx < size && dy >= 0 && dy < size {
+				half := size / 2
+				distance := dy - half
+				if distance < 0 {
+					distance = -distance
+				}
+				if dx <= size-2*distance {
+					img.Set(x, y, foreground)
+				}
+			}
+		}
+	}
+
+	return img
+}
@@ -0,0 +1,278 @@
+package Media
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Returned for files whose ISO-BMFF box structure is broken or missing required boxes
+var ErrInvalidMP4 = errors.New("file is not a valid MP4 video")
+
+// Largest moov box that is loaded into memory, real files stay far below this
+const maxMoovSize = 64 * 1024 * 1024
+
+// Technical details read from the boxes of an MP4 file
+type MP4Info struct {
+	Duration   float64 // Seconds
+	Width      int
+	Height     int
+	VideoCodec string // Sample entry type such as avc1, hvc1 or av01
+	AudioCodec string // Sample entry type such as mp4a or Opus, empty without audio
+	Bitrate    int64  // Average bits per second over the whole file
+	FastStart  bool   // The moov box comes before the media data, so playback can start early
+}
+
+type mp4Box struct {
+	Type       string
+	HeaderSize int64
+	Size       int64 // Including the header
+}
+
+// Reads a box header at the current position. A size of zero means the box runs to the end.
+func readBoxHeader(r io.Reader, remaining int64) (mp4Box, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return mp4Box{}, err
+	}
+
+	box := mp4Box{Type: string(header[4:8]), HeaderSize: 8, Size: int64(binary.BigEndian.Uint32(header[0:4]))}
+	switch box.Size {
+	case 0:
+		box.Size = remaining
+	case 1:
+		var largeSize [8]byte
+		if _, err := io.ReadFull(r, largeSize[:]); err != nil {
+			return mp4Box{}, err
+		}
+		box.HeaderSize = 16
+		box.Size = int64(binary.BigEndian.Uint64(largeSize[:]))
+	}
+
+	if box.Size < box.HeaderSize || box.Size > remaining {
+		return mp4Box{}, fmt.Errorf("%w: box %q has an invalid size", ErrInvalidMP4, box.Type)
+	}
+
+	return box, nil
+}
+
+// Walks the top-level boxes of an MP4 file and reads the movie header and tracks from
+// the moov box. Only box headers and the moov box itself are read, never the media data.
+func ParseMP4(r io.ReadSeeker, size int64) (MP4Info, error) {
+	var moov []byte
+	mdatSeen := false
+	info := MP4Info{}
+
+	for offset := int64(0); offset < size; {
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return MP4Info{}, err
+		}
+
+		box, err := readBoxHeader(r, size-offset)
+		if err != nil {
+			return MP4Info{}, truncated(err)
+		}
+
+		switch box.Type {
+		case "moov":
+			if moov != nil {
+				return MP4Info{}, fmt.Errorf("%w: more than one moov box", ErrInvalidMP4)
+			}
+			if box.Size-box.HeaderSize > maxMoovSize {
+				return MP4Info{}, fmt.Errorf("%w: moov box is too large", ErrInvalidMP4)
+			}
+			moov = make([]byte, box.Size-box.HeaderSize)
+			if _, err := io.ReadFull(r, moov); err != nil {
+				return MP4Info{}, truncated(err)
+			}
+			info.FastStart = !mdatSeen
+		case "mdat":
+			mdatSeen = true
+		}
+
+		offset += box.Size
+	}
+
+	if moov == nil {
+		return MP4Info{}, fmt.Errorf("%w: missing moov box", ErrInvalidMP4)
+	}
+
+	if err := parseMoov(moov, &info); err != nil {
+		return MP4Info{}, err
+	}
+
+	if info.VideoCodec == "" {
+		return MP4Info{}, fmt.Errorf("%w: no video track", ErrInvalidMP4)
+	}
+
+	if info.Duration > 0 {
+		info.Bitrate = int64(float64(size*8) / info.Duration)
+	}
+
+	return info, nil
+}
+
+// Reports a file that ends in the middle of a box as invalid rather than as a read error
+func truncated(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: file ends in the middle of a box", ErrInvalidMP4)
+	}
+	return err
+}
+
+// Calls visit for every child box in data, which holds the payload of a container box
+func eachBox(data []byte, visit func(boxType string, payload []byte) error) error {
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return fmt.Errorf("%w: truncated box header", ErrInvalidMP4)
+		}
+
+		size := uint64(binary.BigEndian.Uint32(data[0:4]))
+		boxType := string(data[4:8])
+		headerSize := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return fmt.Errorf("%w: truncated box header", ErrInvalidMP4)
+			}
+			size = binary.BigEndian.Uint64(data[8:16])
+			headerSize = 16
+		}
+
+		if size < headerSize || size > uint64(len(data)) {
+			return fmt.Errorf("%w: box %q has an invalid size", ErrInvalidMP4, boxType)
+		}
+
+		if err := visit(boxType, data[headerSize:size]); err != nil {
+			return err
+		}
+		data = data[size:]
+	}
+
+	return nil
+}
+
+// Finds the first child box of the given type
+func findBox(data []byte, boxType string) ([]byte, error) {
+	var found []byte
+	err := eachBox(data, func(childType string, payload []byte) error {
+		if found == nil && childType == boxType {
+			found = payload
+		}
+		return nil
+	})
+	return found, err
+}
+
+func parseMoov(moov []byte, info *MP4Info) error {
+	return eachBox(moov, func(boxType string, payload []byte) error {
+		switch boxType {
+		case "mvhd":
+			duration, err := parseMvhd(payload)
+			if err != nil {
+				return err
+			}
+			info.Duration = duration
+		case "trak":
+			return parseTrak(payload, info)
+		}
+		return nil
+	})
+}
+
+// Reads the movie duration in seconds from the movie header
+func parseMvhd(payload []byte) (float64, error) {
+	if len(payload) < 4 {
+		return 0, fmt.Errorf("%w: truncated mvhd box", ErrInvalidMP4)
+	}
+
+	var timescale uint32
+	var duration uint64
+	if payload[0] == 1 {
+		if len(payload) < 32 {
+			return 0, fmt.Errorf("%w: truncated mvhd box", ErrInvalidMP4)
+		}
+		timescale = binary.BigEndian.Uint32(payload[20:24])
+		duration = binary.BigEndian.Uint64(payload[24:32])
+	} else {
+		if len(payload) < 20 {
+			return 0, fmt.Errorf("%w: truncated mvhd box", ErrInvalidMP4)
+		}
+		timescale = binary.BigEndian.Uint32(payload[12:16])
+		duration = uint64(binary.BigEndian.Uint32(payload[16:20]))
+	}
+
+	// Fragmented files may leave the duration unknown
+	if timescale == 0 || duration == 0xFFFFFFFF || duration == 0xFFFFFFFFFFFFFFFF {
+		return 0, nil
+	}
+
+	return float64(duration) / float64(timescale), nil
+}
+
+// Reads the handler type and first sample entry of a track, keeping the first video and audio track
+func parseTrak(trak []byte, info *MP4Info) error {
+	mdia, err := findBox(trak, "mdia")
+	if err != nil || mdia == nil {
+		return err
+	}
+
+	hdlr, err := findBox(mdia, "hdlr")
+	if err != nil {
+		return err
+	}
+	if len(hdlr) < 12 {
+		return fmt.Errorf("%w: missing or truncated hdlr box", ErrInvalidMP4)
+	}
+	handler := string(hdlr[8:12])
+	if handler != "vide" && handler != "soun" {
+		return nil
+	}
+
+	stsd, err := findPath(mdia, "minf", "stbl", "stsd")
+	if err != nil {
+		return err
+	}
+	// Version and flags, entry count, then the first sample entry header
+	if len(stsd) < 16 {
+		return fmt.Errorf("%w: missing or truncated stsd box", ErrInvalidMP4)
+	}
+	entry := stsd[8:]
+	entryType := strings.TrimSpace(string(entry[4:8]))
+
+	if handler == "soun" {
+		if info.AudioCodec == "" {
+			info.AudioCodec = entryType
+		}
+		return nil
+	}
+
+	if info.VideoCodec != "" {
+		return nil
+	}
+	info.VideoCodec = entryType
+
+	// Visual sample entries keep the width and height 32 bytes into the entry
+	if len(entry) >= 36 {
+		info.Width = int(binary.BigEndian.Uint16(entry[32:34]))
+		info.Height = int(binary.BigEndian.Uint16(entry[34:36]))
+	}
+
+	return nil
+}
+
+// Follows a chain of nested box types, returning nil without an error when any of them is missing
+func findPath(data []byte, boxTypes ...string) ([]byte, error) {
+	for _, boxType := range boxTypes {
+		child, err := findBox(data, boxType)
+		if err != nil || child == nil {
+			return nil, err
+		}
+		data = child
+	}
+	return data, nil
+}
@@ -0,0 +1,153 @@
+package Media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// Builds a box with a 32-bit size
+func box(boxType string, children ...[]byte) []byte {
+	payload := bytes.Join(children, nil)
+	data := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint32(data[0:4], uint32(8+len(payload)))
+	copy(data[4:8], boxType)
+	return append(data, payload...)
+}
+
+// Builds a box with a 64-bit size
+func largeBox(boxType string, children ...[]byte) []byte {
+	payload := bytes.Join(children, nil)
+	data := make([]byte, 16, 16+len(payload))
+	binary.BigEndian.PutUint32(data[0:4], 1)
+	copy(data[4:8], boxType)
+	binary.BigEndian.PutUint64(data[8:16], uint64(16+len(payload)))
+	return append(data, payload...)
+}
+
+func uint32Bytes(values ...uint32) []byte {
+	data := make([]byte, 4*len(values))
+	for i, value := range values {
+		binary.BigEndian.PutUint32(data[4*i:], value)
+	}
+	return data
+}
+
+// Movie header version 0: version and flags, creation and modification time, timescale, duration
+func mvhd(timescale uint32, duration uint32) []byte {
+	return box("mvhd", uint32Bytes(0, 0, 0, timescale, duration), make([]byte, 80))
+}
+
+// Movie header version 1 with 64-bit times and duration
+func mvhdV1(timescale uint32, duration uint64) []byte {
+	payload := make([]byte, 32)
+	payload[0] = 1
+	binary.BigEndian.PutUint32(payload[20:24], timescale)
+	binary.BigEndian.PutUint64(payload[24:32], duration)
+	return box("mvhd", payload, make([]byte, 80))
+}
+
+// A track with a handler and a single sample entry, visual entries carry the frame size
+func trak(handler string, entryType string, width uint16, height uint16) []byte {
+	hdlr := box("hdlr", uint32Bytes(0, 0), []byte(handler), make([]byte, 13))
+
+	entry := make([]byte, 36)
+	binary.BigEndian.PutUint32(entry[0:4], uint32(len(entry)))
+	copy(entry[4:8], entryType)
+	binary.BigEndian.PutUint16(entry[32:34], width)
+	binary.BigEndian.PutUint16(entry[34:36], height)
+	stsd := box("stsd", uint32Bytes(0, 1), entry)
+
+	return box("trak", box("mdia", hdlr, box("minf", box("stbl", stsd))))
+}
+
+func TestParseMP4(t *testing.T) {
+	ftyp := box("ftyp", []byte("isom"), uint32Bytes(0), []byte("isomavc1"))
+	video := trak("vide", "avc1", 1280, 720)
+	audio := trak("soun", "mp4a", 0, 0)
+	moov := box("moov", mvhd(1000, 5000), video, audio)
+	mdat := box("mdat", make([]byte, 100))
+
+	// A moov whose trak uses a 64-bit size
+	moovLargeTrak := box("moov", mvhd(1000, 5000), largeBox("trak", video[8:]))
+	// mdat with size zero runs to the end of the file
+	openMdat := append(make([]byte, 8), make([]byte, 100)...)
+	copy(openMdat[4:8], "mdat")
+
+	full := bytes.Join([][]byte{ftyp, moov, mdat}, nil)
+
+	tests := []struct {
+		name    string
+		file    []byte
+		want    MP4Info
+		wantErr bool
+	}{
+		{
+			name: "fast start",
+			file: full,
+			want: MP4Info{Duration: 5, Width: 1280, Height: 720, VideoCodec: "avc1", AudioCodec: "mp4a", FastStart: true},
+		},
+		{
+			name: "moov after media data",
+			file: bytes.Join([][]byte{ftyp, mdat, moov}, nil),
+			want: MP4Info{Duration: 5, Width: 1280, Height: 720, VideoCodec: "avc1", AudioCodec: "mp4a"},
+		},
+		{
+			name: "64-bit mdat size",
+			file: bytes.Join([][]byte{ftyp, moov, largeBox("mdat", make([]byte, 100))}, nil),
+			want: MP4Info{Duration: 5, Width: 1280, Height: 720, VideoCodec: "avc1", AudioCodec: "mp4a", FastStart: true},
+		},
+		{
+			name: "64-bit box inside moov",
+			file: bytes.Join([][]byte{ftyp, moovLargeTrak, mdat}, nil),
+			want: MP4Info{Duration: 5, Width: 1280, Height: 720, VideoCodec: "avc1", FastStart: true},
+		},
+		{
+			name: "version 1 movie header",
+			file: bytes.Join([][]byte{ftyp, box("moov", mvhdV1(90000, 90000*3), video), mdat}, nil),
+			want: MP4Info{Duration: 3, Width: 1280, Height: 720, VideoCodec: "avc1", FastStart: true},
+		},
+		{
+			name: "unknown duration",
+			file: bytes.Join([][]byte{ftyp, box("moov", mvhd(1000, 0xFFFFFFFF), video), mdat}, nil),
+			want: MP4Info{Width: 1280, Height: 720, VideoCodec: "avc1", FastStart: true},
+		},
+		{
+			name: "last box without size",
+			file: bytes.Join([][]byte{ftyp, moov, openMdat}, nil),
+			want: MP4Info{Duration: 5, Width: 1280, Height: 720, VideoCodec: "avc1", AudioCodec: "mp4a", FastStart: true},
+		},
+		{name: "truncated in the moov box", file: full[:len(ftyp)+len(moov)/2], wantErr: true},
+		{name: "truncated box header", file: full[:len(full)-len(mdat)+4], wantErr: true},
+		{name: "truncated 64-bit size", file: append(append([]byte{}, ftyp...), largeBox("mdat")[:12]...), wantErr: true},
+		{name: "box larger than the file", file: append(append([]byte{}, ftyp...), box("mdat", make([]byte, 100))[:50]...), wantErr: true},
+		{name: "truncated child box", file: bytes.Join([][]byte{ftyp, box("moov", mvhd(1000, 5000), video, []byte{0, 0, 0}), mdat}, nil), wantErr: true},
+		{name: "truncated movie header", file: bytes.Join([][]byte{ftyp, box("moov", box("mvhd", uint32Bytes(0, 0)), video), mdat}, nil), wantErr: true},
+		{name: "missing moov", file: bytes.Join([][]byte{ftyp, mdat}, nil), wantErr: true},
+		{name: "audio only", file: bytes.Join([][]byte{ftyp, box("moov", mvhd(1000, 5000), audio), mdat}, nil), wantErr: true},
+		{name: "two moov boxes", file: bytes.Join([][]byte{ftyp, moov, moov, mdat}, nil), wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			info, err := ParseMP4(bytes.NewReader(test.file), int64(len(test.file)))
+			if test.wantErr {
+				if !errors.Is(err, ErrInvalidMP4) {
+					t.Fatalf("ParseMP4() error = %v, want ErrInvalidMP4", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseMP4() error = %v", err)
+			}
+
+			if test.want.Duration > 0 {
+				test.want.Bitrate = int64(float64(len(test.file)*8) / test.want.Duration)
+			}
+			if info != test.want {
+				t.Errorf("ParseMP4() = %+v, want %+v", info, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package Media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"path/filepath"
+	"strings"
+)
+
+// Number of leading bytes Sniff needs to recognise a container
+const SniffLength = 4096
+
+type Container struct {
+	Name        string // mp4, webm or mkv
+	ContentType string
+	Extension   string
+}
+
+var (
+	MP4  = Container{Name: "mp4", ContentType: "video/mp4", Extension: ".mp4"}
+	WebM = Container{Name: "webm", ContentType: "video/webm", Extension: ".webm"}
+	MKV  = Container{Name: "mkv", ContentType: "video/x-matroska", Extension: ".mkv"}
+)
+
+var ebmlMagic = []byte{0x1A, 0x45, 0xDF, 0xA3}
+
+// ISO-BMFF brands of video files. The same box format is used for audio and images, so an
+// ftyp box alone does not make a file a video.
+var videoBrands = map[string]bool{
+	"isom": true, "iso2": true, "iso3": true, "iso4": true, "iso5": true, "iso6": true,
+	"mp41": true, "mp42": true, "avc1": true, "dash": true, "mmp4": true,
+	"M4V ": true, "M4VH": true, "M4VP": true, "f4v ": true, "qt  ": true,
+	"3gp4": true, "3gp5": true, "3gp6": true, "3g2a": true,
+}
+
+// Audio and image brands, files with one of these as their major brand are no video even when
+// they list video brands as compatible, as M4A files do
+var nonVideoBrands = map[string]bool{
+	"M4A ": true, "M4B ": true, "M4P ": true, "F4A ": true, "F4B ": true,
+	"mif1": true, "msf1": true, "heic": true, "heix": true, "heim": true, "heis": true,
+	"hevc": true, "hevx": true, "avif": true, "avis": true,
+}
+
+// Detects the video container from the first bytes of a file, ignoring whatever
+// name or MIME type the client claimed
+func Sniff(header []byte) (Container, bool) {
+	// ISO-BMFF files start with a box size followed by the ftyp box type
+	if len(header) >= 12 && string(header[4:8]) == "ftyp" {
+		if isVideoFtyp(header) {
+			return MP4, true
+		}
+		return Container{}, false
+	}
+
+	if bytes.HasPrefix(header, ebmlMagic) {
+		switch ebmlDocType(header) {
+		case "webm":
+			return WebM, true
+		case "matroska":
+			return MKV, true
+		}
+	}
+
+	return Container{}, false
+}
+
+// Checks the brands of a leading ftyp box: the major brand must not be an audio or image brand,
+// and either it or one of the compatible brands must be a video brand
+func isVideoFtyp(header []byte) bool {
+	start := 8
+	end := int(binary.BigEndian.Uint32(header[0:4]))
+	switch end {
+	case 0: // The box runs to the end of the file
+		end = len(header)
+	case 1: // A 64-bit size follows the box type
+		if len(header) < 20 {
+			return false
+		}
+		start = 16
+		end = int(binary.BigEndian.Uint64(header[8:16]))
+	}
+	if end > len(header) {
+		end = len(header)
+	}
+	if end < start+8 {
+		return false
+	}
+
+	major := string(header[start : start+4])
+	if nonVideoBrands[major] {
+		return false
+	}
+	if videoBrands[major] {
+		return true
+	}
+
+	// Brands after the major brand and its minor version
+	for offset := start + 8; offset+4 <= end; offset += 4 {
+		if videoBrands[string(header[offset:offset+4])] {
+			return true
+		}
+	}
+	return false
+}
+
+// Reads the DocType element (ID 0x4282) from the EBML header
+func ebmlDocType(header []byte) string {
+	index := bytes.Index(header, []byte{0x42, 0x82})
+	if index < 0 || index+2 >= len(header) {
+		return ""
+	}
+
+	size, width := readVint(header[index+2:])
+	start := index + 2 + width
+	if width == 0 || size <= 0 || start+size > len(header) {
+		return ""
+	}
+
+	return strings.TrimRight(string(header[start:start+size]), "\x00")
+}
+
+// Decodes an EBML variable length integer, returning its value and width in bytes
+func readVint(data []byte) (int, int) {
+	if len(data) == 0 {
+		return 0, 0
+	}
+
+	width := 1
+	for mask := byte(0x80); width <= 8 && data[0]&mask == 0; mask >>= 1 {
+		width++
+	}
+	if width > 8 || width > len(data) {
+		return 0, 0
+	}
+
+	value := int(data[0] & (0xFF >> width))
+	for _, b := range data[1:width] {
+		value = value<<8 | int(b)
+	}
+
+	return value, width
+}
+
+// Reports whether a filename's extension contradicts the detected container. Any extension
+// other than the video ones is rejected, a filename without one is judged by its content alone
+// since resumable uploads do not have to send a filename.
+func ExtensionMismatch(filename string, container Container) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case "":
+		return false
+	case ".mp4", ".m4v", ".mov":
+		return container != MP4
+	case ".webm":
+		return container != WebM && container != MKV
+	case ".mkv":
+		return container != MKV && container != WebM
+	default:
+		return true
+	}
+}
+
+// File extension for a stored content type, older videos without one are MP4
+func ExtensionFor(contentType string) string {
+	for _, container := range []Container{MP4, WebM, MKV} {
+		if container.ContentType == contentType {
+			return container.Extension
+		}
+	}
+	return MP4.Extension
+}
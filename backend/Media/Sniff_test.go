@@ -0,0 +1,89 @@
+package Media
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// Builds an ftyp box with the given major and compatible brands
+func ftypBox(major string, compatible ...string) []byte {
+	box := make([]byte, 16, 16+4*len(compatible))
+	binary.BigEndian.PutUint32(box[0:4], uint32(16+4*len(compatible)))
+	copy(box[4:8], "ftyp")
+	copy(box[8:12], major)
+	for _, brand := range compatible {
+		box = append(box, brand...)
+	}
+	return box
+}
+
+func TestSniff(t *testing.T) {
+	largeFtyp := make([]byte, 24)
+	binary.BigEndian.PutUint32(largeFtyp[0:4], 1)
+	copy(largeFtyp[4:8], "ftyp")
+	binary.BigEndian.PutUint64(largeFtyp[8:16], 24)
+	copy(largeFtyp[16:20], "mp42")
+
+	webm := append(append([]byte{}, ebmlMagic...), 0x9F, 0x42, 0x82, 0x84, 'w', 'e', 'b', 'm')
+	mkv := append(append([]byte{}, ebmlMagic...), 0x9F, 0x42, 0x82, 0x88, 'm', 'a', 't', 'r', 'o', 's', 'k', 'a')
+
+	tests := []struct {
+		name   string
+		header []byte
+		want   Container
+		ok     bool
+	}{
+		{"mp4", ftypBox("isom", "isom", "iso2", "avc1", "mp41"), MP4, true},
+		{"quicktime", ftypBox("qt  ", "qt  "), MP4, true},
+		{"unknown major with video compatible brand", ftypBox("XAVC", "XAVC", "mp42", "iso2"), MP4, true},
+		{"64-bit box size", largeFtyp, MP4, true},
+		{"m4a audio", ftypBox("M4A ", "M4A ", "mp42", "isom"), Container{}, false},
+		{"heic image", ftypBox("heic", "mif1", "heic"), Container{}, false},
+		{"avif image", ftypBox("avif", "avif", "mif1", "miaf"), Container{}, false},
+		{"image with generic major brand", ftypBox("mif1", "mif1", "isom"), Container{}, false},
+		{"unknown brands only", ftypBox("abcd", "efgh"), Container{}, false},
+		{"truncated ftyp", ftypBox("isom")[:10], Container{}, false},
+		{"webm", webm, WebM, true},
+		{"matroska", mkv, MKV, true},
+		{"plain text", []byte("just some text, not a video"), Container{}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := Sniff(test.header)
+			if got != test.want || ok != test.ok {
+				t.Errorf("Sniff() = %v, %v, want %v, %v", got, ok, test.want, test.ok)
+			}
+		})
+	}
+}
+
+func TestExtensionMismatch(t *testing.T) {
+	tests := []struct {
+		filename  string
+		container Container
+		want      bool
+	}{
+		{"clip.mp4", MP4, false},
+		{"clip.MOV", MP4, false},
+		{"clip.m4v", MP4, false},
+		{"clip.webm", WebM, false},
+		{"clip.webm", MKV, false},
+		{"clip.mkv", WebM, false},
+		{"clip", MP4, false},
+		{"", WebM, false},
+		{"clip.mp4", WebM, true},
+		{"clip.mkv", MP4, true},
+		{"clip.pdf", MP4, true},
+		{"clip.exe", WebM, true},
+		{"clip.mp4.exe", MP4, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.filename, func(t *testing.T) {
+			if got := ExtensionMismatch(test.filename, test.container); got != test.want {
+				t.Errorf("ExtensionMismatch(%q, %v) = %v, want %v", test.filename, test.container, got, test.want)
+			}
+		})
+	}
+}
@@ -37,6 +37,10 @@ func GetMongoDB() *mongo.Client {
 	return mongoDBInstance
 }
 
+func GetDatabase() *mongo.Database {
+	return GetMongoDB().Database("Pametni-Paketnik-baza") //Change this
+}
+
 func GetCollection(collection string) *mongo.Collection {
-	return GetMongoDB().Database("Pametni-Paketnik-baza").Collection(collection) //Change this
+	return GetDatabase().Collection(collection)
 }
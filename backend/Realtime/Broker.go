@@ -0,0 +1,94 @@
+package Realtime
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	EventPost         = "post"
+	EventComment      = "comment"
+	EventNotification = "notification"
+)
+
+type Event struct {
+	Type     string      `json:"type"`
+	PostId   string      `json:"post_id,omitempty"`
+	Username string      `json:"-"` // Recipient of private events, empty for public ones
+	Data     interface{} `json:"data"`
+}
+
+// A connected client, only receiving the events it is allowed and interested to see
+type Subscriber struct {
+	Events   chan Event
+	username string
+	postId   string
+}
+
+var (
+	subscribersMutex sync.RWMutex
+	subscribers      = make(map[*Subscriber]struct{})
+
+	// Set while a change stream is delivering database events, so handlers do not publish them twice
+	watchingChanges atomic.Bool
+)
+
+func Subscribe(username string, postId string) *Subscriber {
+	subscriber := &Subscriber{
+		Events:   make(chan Event, 16),
+		username: username,
+		postId:   postId,
+	}
+
+	subscribersMutex.Lock()
+	subscribers[subscriber] = struct{}{}
+	subscribersMutex.Unlock()
+
+	return subscriber
+}
+
+func Unsubscribe(subscriber *Subscriber) {
+	subscribersMutex.Lock()
+	delete(subscribers, subscriber)
+	subscribersMutex.Unlock()
+}
+
+// Publishes an event from a request handler. When change streams are active the same
+// event will arrive from the database, so the in-process copy is skipped.
+func Emit(event Event) {
+	if watchingChanges.Load() {
+		return
+	}
+
+	publish(event)
+}
+
+func publish(event Event) {
+	subscribersMutex.RLock()
+	defer subscribersMutex.RUnlock()
+
+	for subscriber := range subscribers {
+		if !subscriber.wants(event) {
+			continue
+		}
+
+		// Slow clients miss events instead of blocking everyone else
+		select {
+		case subscriber.Events <- event:
+		default:
+		}
+	}
+}
+
+func (subscriber *Subscriber) wants(event Event) bool {
+	switch event.Type {
+	case EventPost:
+		return true
+	case EventComment:
+		return subscriber.postId != "" && subscriber.postId == event.PostId
+	case EventNotification:
+		return subscriber.username == event.Username
+	default:
+		return false
+	}
+}
@@ -0,0 +1,92 @@
+package Realtime
+
+import (
+	"backend/Mongo"
+	"backend/Schemas"
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type changeEvent struct {
+	Namespace struct {
+		Collection string `bson:"coll"`
+	} `bson:"ns"`
+	FullDocument bson.Raw `bson:"fullDocument"`
+}
+
+// Starts watching the database for new posts, comments and notifications. Standalone
+// MongoDB servers do not support change streams, in which case handlers keep publishing
+// events in-process.
+func Start() {
+	go func() {
+		for {
+			err := watch()
+			watchingChanges.Store(false)
+			log.Printf("(Realtime) Change stream unavailable, using in-process events: %v", err)
+			time.Sleep(time.Minute)
+		}
+	}()
+}
+
+func watch() error {
+	database := Mongo.GetCollection("studenci_district").Database()
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"operationType": "insert",
+			"ns.coll":       bson.M{"$in": bson.A{"studenci_district", "melje_district", "notifications"}},
+		}}},
+	}
+
+	stream, err := database.Watch(context.Background(), pipeline, options.ChangeStream().SetFullDocument(options.UpdateLookup))
+	if err != nil {
+		return err
+	}
+	defer stream.Close(context.Background())
+
+	watchingChanges.Store(true)
+	log.Printf("(Realtime) Watching change stream")
+
+	for stream.Next(context.Background()) {
+		var change changeEvent
+		if err := stream.Decode(&change); err != nil {
+			log.Printf("(Realtime) Error decoding change: %v", err)
+			continue
+		}
+
+		if event, ok := eventFromChange(change); ok {
+			publish(event)
+		}
+	}
+
+	return stream.Err()
+}
+
+func eventFromChange(change changeEvent) (Event, bool) {
+	switch change.Namespace.Collection {
+	case "studenci_district":
+		var post Schemas.Post
+		if err := bson.Unmarshal(change.FullDocument, &post); err != nil {
+			return Event{}, false
+		}
+		return Event{Type: EventPost, PostId: post.ID.Hex(), Data: post}, true
+	case "melje_district":
+		var comment Schemas.Comment
+		if err := bson.Unmarshal(change.FullDocument, &comment); err != nil {
+			return Event{}, false
+		}
+		return Event{Type: EventComment, PostId: comment.PostId, Data: comment}, true
+	case "notifications":
+		var notification Schemas.Notification
+		if err := bson.Unmarshal(change.FullDocument, &notification); err != nil {
+			return Event{}, false
+		}
+		return Event{Type: EventNotification, Username: notification.Username, Data: notification}, true
+	}
+
+	return Event{}, false
+}
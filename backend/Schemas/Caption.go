@@ -0,0 +1,18 @@
+package Schemas
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Caption track of a video in one language, SRT uploads are converted so it is always WebVTT
+type CaptionTrack struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	VideoId    string             `json:"video_id" bson:"video_id"`
+	Language   string             `json:"language" bson:"language"` // BCP 47 tag such as sl or en-GB
+	Label      string             `json:"label" bson:"label"`
+	Content    string             `json:"-" bson:"content"`
+	CueCount   int                `json:"cue_count" bson:"cue_count"`
+	UploadedBy string             `json:"uploaded_by" bson:"uploaded_by"`
+	UpdatedAt  time.Time          `json:"updated_at" bson:"updated_at"`
+}
@@ -1,11 +1,21 @@
 package Schemas
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
 
 type Comment struct {
 	ID          primitive.ObjectID `bson:"_id,omitempty"`
 	PostId      string             `json:"post_id" bson:"post_id"`
+	ParentId    string             `json:"parent_id,omitempty" bson:"parent_id,omitempty"`
+	Path        []string           `json:"path" bson:"path"` // Ancestor comment ids, root first
+	Depth       int                `json:"depth" bson:"depth"`
+	ReplyCount  int                `json:"reply_count" bson:"reply_count"`
 	Username    string             `json:"username" bson:"username"`
 	Description string             `json:"description" bson:"description"`
+	Mentions    []string           `json:"mentions" bson:"mentions"`
 	Date        string             `json:"date" bson:"date"`
+	EditedAt    *time.Time         `json:"edited_at,omitempty" bson:"edited_at,omitempty"`
+	Replies     []Comment          `json:"replies" bson:"-"`
 }
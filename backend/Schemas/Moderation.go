@@ -0,0 +1,58 @@
+package Schemas
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Decisions a moderator can take on a flagged video
+const (
+	ModerationRestore = "restore" // Clears the flags and brings a removed video back
+	ModerationRemove  = "remove"  // Hides the video from everyone, it is kept for appeals
+	ModerationWarn    = "warn"    // Clears the flags and gives the uploader a warning
+	ModerationBan     = "ban"     // Removes the video and bans the uploader
+)
+
+var ModerationActions = []string{
+	ModerationRestore,
+	ModerationRemove,
+	ModerationWarn,
+	ModerationBan,
+}
+
+const (
+	AppealOpen     = "open"
+	AppealResolved = "resolved"
+	AppealClosed   = "closed" // The video was deleted before the appeal was decided
+)
+
+// An entry of the moderation audit log, entries are never changed or deleted
+type ModerationDecision struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id"`
+	TargetType  string             `json:"target_type" bson:"target_type"` // Missing on decisions from before reports, which are all on videos
+	TargetId    string             `json:"target_id" bson:"target_id"`
+	VideoId     string             `json:"video_id,omitempty" bson:"video_id,omitempty"` // Only set for videos
+	Uploader    string             `json:"uploader_username" bson:"uploader_username"`   // Owner of the content
+	Moderator   string             `json:"moderator" bson:"moderator"`
+	Action      string             `json:"action" bson:"action"`
+	Reason      string             `json:"reason" bson:"reason"`
+	FlagScore   float64            `json:"flag_score" bson:"flag_score"`                         // Score of the counting flags when the decision was made
+	FlagReasons map[string]int     `json:"flag_reasons,omitempty" bson:"flag_reasons,omitempty"` // Number of counting flags per reason
+	AppealId    string             `json:"appeal_id,omitempty" bson:"appeal_id,omitempty"`       // Set when the decision resolved an appeal
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// An uploader's appeal against a decision, the id is the id of the appealed decision
+type ModerationAppeal struct {
+	ID           string     `json:"id" bson:"_id"`
+	VideoId      string     `json:"video_id" bson:"video_id"`
+	Uploader     string     `json:"uploader_username" bson:"uploader_username"`
+	Message      string     `json:"message" bson:"message"`
+	Action       string     `json:"action" bson:"action"`         // Action of the appealed decision
+	DecidedBy    string     `json:"decided_by" bson:"decided_by"` // Moderator of the appealed decision, who can not decide the appeal
+	Status       string     `json:"status" bson:"status"`
+	ResolutionId string     `json:"resolution_id,omitempty" bson:"resolution_id,omitempty"`
+	ResolvedBy   string     `json:"resolved_by,omitempty" bson:"resolved_by,omitempty"`
+	ResolvedAt   *time.Time `json:"resolved_at,omitempty" bson:"resolved_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,42 @@
+package Schemas
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+const (
+	NotificationMention        = "mention"
+	NotificationCommentOnPost  = "comment_on_post"
+	NotificationCommentReply   = "comment_reply"
+	NotificationVideoFlagged   = "video_flagged"
+	NotificationVideoFlagReset = "video_flag_reset"
+	NotificationAnswerAccepted = "answer_accepted"
+	NotificationVideoComment   = "video_comment"
+	NotificationModeration     = "moderation_decision"
+)
+
+// Every notification type a user can switch on or off in their preferences
+var NotificationTypes = []string{
+	NotificationMention,
+	NotificationCommentOnPost,
+	NotificationCommentReply,
+	NotificationVideoFlagged,
+	NotificationVideoFlagReset,
+	NotificationAnswerAccepted,
+	NotificationVideoComment,
+	NotificationModeration,
+}
+
+type Notification struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	Username  string             `json:"username" bson:"username"` // Recipient
+	Type      string             `json:"type" bson:"type"`
+	Actor     string             `json:"actor" bson:"actor"` // User who triggered the notification
+	Message   string             `json:"message" bson:"message"`
+	PostId    string             `json:"post_id,omitempty" bson:"post_id,omitempty"`
+	CommentId string             `json:"comment_id,omitempty" bson:"comment_id,omitempty"`
+	VideoId   string             `json:"video_id,omitempty" bson:"video_id,omitempty"`
+	Read      bool               `json:"read" bson:"read"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,23 @@
+package Schemas
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+const (
+	PlaylistUser   = "playlist" // Owned and edited by a single user
+	PlaylistCourse = "course"   // Curated by moderators
+)
+
+type Playlist struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty"`
+	Name        string             `json:"name" bson:"name"`
+	Description string             `json:"description" bson:"description"`
+	Owner       string             `json:"owner" bson:"owner"`
+	Kind        string             `json:"kind" bson:"kind"`
+	Public      bool               `json:"public" bson:"public"`
+	VideoIds    []string           `json:"video_ids" bson:"video_ids"` // In playback order
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time          `json:"updated_at" bson:"updated_at"`
+}
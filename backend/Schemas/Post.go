@@ -3,9 +3,12 @@ package Schemas
 import "go.mongodb.org/mongo-driver/bson/primitive"
 
 type Post struct {
-	ID       primitive.ObjectID `bson:"_id,omitempty"`
-	Username string             `json:"username" bson:"username"`
-	Problem  string             `json:"problem" bson:"problem"`
-	Date     string             `json:"date" bson:"date"`
-	Comments []Comment          `json:"comments"`
+	ID                primitive.ObjectID `bson:"_id,omitempty"`
+	Username          string             `json:"username" bson:"username"`
+	Problem           string             `json:"problem" bson:"problem"`
+	Mentions          []string           `json:"mentions" bson:"mentions"`
+	Date              string             `json:"date" bson:"date"`
+	AcceptedCommentId string             `json:"accepted_comment_id,omitempty" bson:"accepted_comment_id,omitempty"`
+	Comments          []Comment          `json:"comments"`
+	CommentsTotal     int64              `json:"comments_total" bson:"-"` // Top-level comments, Comments may hold only one page
 }
@@ -0,0 +1,67 @@
+package Schemas
+
+import "time"
+
+// Reasons content can be reported or a video flagged for
+const (
+	FlagSpam          = "spam"
+	FlagInappropriate = "inappropriate"
+	FlagHarassment    = "harassment"
+	FlagCopyright     = "copyright"
+	FlagMisleading    = "misleading"
+	FlagOther         = "other"
+)
+
+var ReportReasons = []string{
+	FlagSpam,
+	FlagInappropriate,
+	FlagHarassment,
+	FlagCopyright,
+	FlagMisleading,
+	FlagOther,
+}
+
+// Kinds of content that can be reported
+const (
+	ReportPost         = "post"
+	ReportComment      = "comment"
+	ReportVideoComment = "video_comment"
+	ReportUser         = "user"
+	ReportVideo        = "video" // Stored as video flags, see VideoFlag
+)
+
+var ReportTargetTypes = []string{
+	ReportPost,
+	ReportComment,
+	ReportVideoComment,
+	ReportUser,
+	ReportVideo,
+}
+
+// One user's report, the id is the target type, the target id and the reporter's user id joined by colons
+type Report struct {
+	ID         string    `json:"-" bson:"_id"`
+	TargetType string    `json:"target_type" bson:"target_type"`
+	TargetId   string    `json:"target_id" bson:"target_id"` // Username for user reports
+	UserID     string    `json:"user_id" bson:"user_id"`
+	Username   string    `json:"username" bson:"username"`
+	Reason     string    `json:"reason" bson:"reason"`
+	Comment    string    `json:"comment,omitempty" bson:"comment,omitempty"`
+	Weight     float64   `json:"weight" bson:"weight"`
+	Cleared    bool      `json:"cleared" bson:"cleared"` // Set once a moderator decided on the target
+	CreatedAt  time.Time `json:"created_at" bson:"created_at"`
+}
+
+// Reports on one piece of content as shown in the moderator inbox, the id is the target type
+// and the target id joined by a colon. Videos are tracked here too so the inbox covers everything.
+type ReportTarget struct {
+	ID         string    `json:"-" bson:"_id"`
+	TargetType string    `json:"target_type" bson:"target_type"`
+	TargetId   string    `json:"target_id" bson:"target_id"`
+	Owner      string    `json:"owner" bson:"owner"` // Author of the content, or the reported user
+	Reports    int       `json:"reports" bson:"reports"`
+	Score      float64   `json:"score" bson:"score"`         // Sum of the report weights
+	Escalated  bool      `json:"escalated" bson:"escalated"` // The score reached the threshold of the target type
+	Open       bool      `json:"open" bson:"open"`
+	UpdatedAt  time.Time `json:"updated_at" bson:"updated_at"`
+}
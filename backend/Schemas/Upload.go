@@ -0,0 +1,25 @@
+package Schemas
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// A resumable upload in progress, its bytes are staged in the upload chunks collection
+type Upload struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	Length     int64              `json:"length" bson:"length"`
+	Offset     int64              `json:"offset" bson:"offset"`
+	Metadata   map[string]string  `json:"metadata" bson:"metadata"`
+	VideoID    string             `json:"video_id,omitempty" bson:"video_id,omitempty"`     // Set once the upload has been finalized
+	Finalizing bool               `json:"finalizing,omitempty" bson:"finalizing,omitempty"` // Set while one request turns the upload into a video
+	CreatedAt  time.Time          `json:"created_at" bson:"created_at"`
+	ExpiresAt  time.Time          `json:"expires_at" bson:"expires_at"`
+}
+
+type UploadChunk struct {
+	ID       primitive.ObjectID `bson:"_id,omitempty"`
+	UploadID primitive.ObjectID `bson:"upload_id"`
+	Offset   int64              `bson:"offset"`
+	Data     []byte             `bson:"data"`
+}
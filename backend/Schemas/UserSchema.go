@@ -3,8 +3,16 @@ package Schemas
 import "go.mongodb.org/mongo-driver/bson/primitive"
 
 type User struct {
-	ID       primitive.ObjectID `bson:"_id,omitempty"`
-	Name     string             `json:"username" bson:"username"`
-	Email    string             `json:"email" bson:"email"`
-	Password string             `json:"password" bson:"password"`
+	ID                      primitive.ObjectID `bson:"_id,omitempty"`
+	Name                    string             `json:"username" bson:"username"`
+	Email                   string             `json:"email" bson:"email"`
+	Password                string             `json:"password" bson:"password"`
+	Admin                   bool               `json:"admin" bson:"admin"`
+	Blocked                 []string           `json:"blocked" bson:"blocked"`                                     // Usernames this user has blocked
+	NotificationPreferences map[string]bool    `json:"notification_preferences" bson:"notification_preferences"`   // Disabled types are false, missing types are enabled
+	CourseGroups            []string           `json:"course_groups" bson:"course_groups"`                         // Assigned by moderators, grants access to restricted videos
+	FlagReputation          *float64           `json:"flag_reputation,omitempty" bson:"flag_reputation,omitempty"` // Weight of this user's flags when weighting is enabled, missing means 1
+	Warnings                int                `json:"warnings" bson:"warnings"`                                   // Moderator warnings received for uploaded videos
+	Banned                  bool               `json:"banned" bson:"banned"`
+	HistoryPaused           bool               `json:"history_paused" bson:"history_paused"` // No watch progress is recorded while paused
 }
@@ -0,0 +1,12 @@
+package Schemas
+
+import "time"
+
+// A stored video file shared by every video with the same content
+type VideoBlob struct {
+	SHA256    string    `json:"sha256" bson:"_id"`
+	BlobID    string    `json:"blob_id" bson:"blob_id"`
+	Size      int64     `json:"size" bson:"size"`
+	Refs      int       `json:"refs" bson:"refs"` // Number of videos using the file
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
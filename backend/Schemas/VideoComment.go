@@ -0,0 +1,15 @@
+package Schemas
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Comment on a video, kept in its own collection so popular videos do not grow without bound
+type VideoComment struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty"`
+	VideoId     string             `json:"video_id" bson:"video_id"`
+	Username    string             `json:"username" bson:"username"`
+	Description string             `json:"description" bson:"description"`
+	Date        time.Time          `json:"date" bson:"date"`
+}
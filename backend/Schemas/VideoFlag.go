@@ -0,0 +1,16 @@
+package Schemas
+
+import "time"
+
+// One user's flag on a video, the id is the video id and the flagger's user id joined by a colon
+type VideoFlag struct {
+	ID        string    `json:"-" bson:"_id"`
+	VideoId   string    `json:"video_id" bson:"video_id"`
+	UserID    string    `json:"user_id" bson:"user_id"`
+	Username  string    `json:"username" bson:"username"`
+	Reason    string    `json:"reason" bson:"reason"`
+	Comment   string    `json:"comment,omitempty" bson:"comment,omitempty"`
+	Weight    float64   `json:"weight" bson:"weight"`   // Added to the video's flag score
+	Cleared   bool      `json:"cleared" bson:"cleared"` // Set when a moderator resets the flags, the flag no longer counts
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,17 @@
+package Schemas
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Note a viewer attached to a moment of a video, private notes are only shown to their author
+type VideoNote struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	VideoId   string             `json:"video_id" bson:"video_id"`
+	Username  string             `json:"username" bson:"username"`
+	Time      float64            `json:"time" bson:"time"` // Seconds from the beginning of the video
+	Text      string             `json:"text" bson:"text"`
+	Public    bool               `json:"public" bson:"public"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,37 @@
+package Schemas
+
+import "time"
+
+// Number of equal parts a video is split into for the retention curve
+const RetentionBuckets = 20
+
+// Activity on a video during one UTC day, the id is the video id and the day joined by a colon
+type VideoDailyStats struct {
+	ID           string           `json:"-" bson:"_id"`
+	VideoId      string           `json:"video_id" bson:"video_id"`
+	Day          string           `json:"day" bson:"day"` // YYYY-MM-DD
+	Views        int64            `json:"views" bson:"views"`
+	Likes        int64            `json:"likes" bson:"likes"`       // Net change, a withdrawn like counts -1
+	Dislikes     int64            `json:"dislikes" bson:"dislikes"` // Net change, a withdrawn dislike counts -1
+	WatchSeconds float64          `json:"watch_seconds" bson:"watch_seconds"`
+	Retention    map[string]int64 `json:"retention,omitempty" bson:"retention,omitempty"` // Bucket index to number of sessions that watched it
+}
+
+// One user's vote on a video, the id is the video id and the username joined by a colon
+type VideoVote struct {
+	ID        string    `bson:"_id"`
+	VideoId   string    `json:"video_id" bson:"video_id"`
+	Username  string    `json:"username" bson:"username"`
+	Value     int       `json:"value" bson:"value"` // 1 for a like, -1 for a dislike
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// What a watch session already added to the statistics, the id is the video id and the session key
+// joined by a colon. Later reports from the session only count what they add on top of it.
+type VideoWatchReport struct {
+	ID             string    `bson:"_id"`
+	VideoId        string    `json:"video_id" bson:"video_id"`
+	WatchedSeconds float64   `json:"watched_seconds" bson:"watched_seconds"`
+	Buckets        []int     `json:"buckets" bson:"buckets"`
+	ExpiresAt      time.Time `json:"expires_at" bson:"expires_at"`
+}
@@ -6,14 +6,76 @@ import (
 )
 
 type Video struct {
-	ID          primitive.ObjectID `bson:"_id,omitempty"`
-	VideoName   string             `json:"video_name" bson:"video_name"`
-	Uploader    string             `json:"uploader_username" bson:"uploader_username"`
-	Description string             `json:"description" bson:"description"`
-	Tags        []string           `json:"tags" bson:"tags"`
-	Comments    []Comment          `json:"comments" bson:"comments"`
-	VideoID     string             `json:"video_id" bson:"video_id"`
-	PostedAt    time.Time          `json:"posted_at" bson:"posted_at"`
-	Flagged     int                `json:"flagged" bson:"flagged"`
-	FlaggedBy   []string           `json:"flagged_by" bson:"flagged_by"`
+	ID           primitive.ObjectID `bson:"_id,omitempty"`
+	VideoName    string             `json:"video_name" bson:"video_name"`
+	Uploader     string             `json:"uploader_username" bson:"uploader_username"`
+	Description  string             `json:"description" bson:"description"`
+	Tags         []string           `json:"tags" bson:"tags"`
+	Comments     []VideoComment     `json:"comments,omitempty" bson:"-"` // Stored in videostore_comments
+	CommentCount int                `json:"comment_count" bson:"comment_count"`
+	VideoID      string             `json:"video_id" bson:"video_id"`
+	BlobID       string             `json:"-" bson:"blob_id,omitempty"` // Stored file, shared by identical uploads
+	SHA256       string             `json:"sha256" bson:"sha256,omitempty"`
+	ContentType  string             `json:"content_type" bson:"content_type"` // Detected from the file content
+	Filename     string             `json:"original_filename" bson:"original_filename"`
+	Size         int64              `json:"size" bson:"size"`
+	Media        *VideoMedia        `json:"media,omitempty" bson:"media,omitempty"` // Only known for MP4 files
+	Poster       *VideoPoster       `json:"poster,omitempty" bson:"poster,omitempty"`
+	Chapters     []VideoChapter     `json:"chapters,omitempty" bson:"chapters,omitempty"` // Ordered by start time
+	PostedAt     time.Time          `json:"posted_at" bson:"posted_at"`
+	Views        int                `json:"views" bson:"views"`
+	Likes        int                `json:"likes" bson:"likes"`
+	Dislikes     int                `json:"dislikes" bson:"dislikes"`
+	Flagged      int                `json:"flagged" bson:"flagged"`                           // Number of flags that still count
+	FlagScore    *float64           `json:"flag_score,omitempty" bson:"flag_score,omitempty"` // Sum of the flag weights, missing on videos flagged before weights existed
+	FlaggedBy    []string           `json:"flagged_by" bson:"flagged_by"`
+	Removed      bool               `json:"removed,omitempty" bson:"removed,omitempty"` // Taken down by a moderator, hidden from everyone
+	Visibility   string             `json:"visibility" bson:"visibility"`
+	CourseGroup  string             `json:"course_group,omitempty" bson:"course_group,omitempty"` // Only for restricted videos
+	PublishAt    *time.Time         `json:"publish_at,omitempty" bson:"publish_at,omitempty"`     // Hidden from everyone but the uploader until then
+	EditHistory  []VideoEdit        `json:"-" bson:"edit_history,omitempty"`
 }
+
+// Technical details read from the video file when it was uploaded
+type VideoMedia struct {
+	Duration   float64 `json:"duration" bson:"duration"` // Seconds
+	Width      int     `json:"width" bson:"width"`
+	Height     int     `json:"height" bson:"height"`
+	VideoCodec string  `json:"video_codec" bson:"video_codec"`
+	AudioCodec string  `json:"audio_codec,omitempty" bson:"audio_codec,omitempty"`
+	Bitrate    int64   `json:"bitrate" bson:"bitrate"` // Bits per second
+	FastStart  bool    `json:"fast_start" bson:"fast_start"`
+}
+
+// Poster image of a video, stored once per thumbnail size
+type VideoPoster struct {
+	Variants  map[string]string `json:"-" bson:"variants"` // Size name to storage blob id
+	UpdatedAt time.Time         `json:"updated_at" bson:"updated_at"`
+}
+
+type VideoChapter struct {
+	Start float64 `json:"start" bson:"start"` // Seconds from the beginning of the video
+	Title string  `json:"title" bson:"title"`
+}
+
+// A change to a video's details, holding the values from before the edit
+type VideoEdit struct {
+	EditedBy    string     `json:"edited_by" bson:"edited_by"`
+	EditedAt    time.Time  `json:"edited_at" bson:"edited_at"`
+	VideoName   string     `json:"video_name" bson:"video_name"`
+	Description string     `json:"description" bson:"description"`
+	Tags        []string   `json:"tags" bson:"tags"`
+	Visibility  string     `json:"visibility" bson:"visibility"`
+	CourseGroup string     `json:"course_group,omitempty" bson:"course_group,omitempty"`
+	PublishAt   *time.Time `json:"publish_at,omitempty" bson:"publish_at,omitempty"`
+}
+
+// Who can find and watch a video, documents without a visibility are public
+const (
+	VideoPublic     = "public"     // Listed and searchable
+	VideoUnlisted   = "unlisted"   // Only reachable through its link
+	VideoPrivate    = "private"    // Only the uploader
+	VideoRestricted = "restricted" // Members of the video's course group
+)
+
+var VideoVisibilities = []string{VideoPublic, VideoUnlisted, VideoPrivate, VideoRestricted}
@@ -0,0 +1,14 @@
+package Schemas
+
+import "time"
+
+// How far a user got in a video, the id is the video id and the username joined by a colon
+type WatchProgress struct {
+	ID        string    `json:"-" bson:"_id"`
+	VideoId   string    `json:"video_id" bson:"video_id"`
+	Username  string    `json:"username" bson:"username"`
+	Position  float64   `json:"position" bson:"position"` // Seconds from the start
+	Duration  float64   `json:"duration" bson:"duration"` // Zero when neither the file nor the player knew it
+	Completed bool      `json:"completed" bson:"completed"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
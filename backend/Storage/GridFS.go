@@ -0,0 +1,199 @@
+package Storage
+
+import (
+	"backend/Mongo"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type GridFS struct {
+	bucket *gridfs.Bucket
+}
+
+type gridfsFileInfo struct {
+	ID         primitive.ObjectID `bson:"_id"`
+	Length     int64              `bson:"length"`
+	ChunkSize  int64              `bson:"chunkSize"`
+	UploadDate time.Time          `bson:"uploadDate"`
+}
+
+type gridfsChunk struct {
+	N    int64  `bson:"n"`
+	Data []byte `bson:"data"`
+}
+
+func NewGridFS() (*GridFS, error) {
+	bucket, err := gridfs.NewBucket(Mongo.GetDatabase())
+	if err != nil {
+		return nil, err
+	}
+
+	return &GridFS{bucket: bucket}, nil
+}
+
+func (g *GridFS) Put(ctx context.Context, id string, name string, source io.Reader) (int64, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return 0, err
+	}
+
+	counter := &countingReader{reader: source}
+	if err := g.bucket.UploadFromStreamWithID(objectID, name, counter); err != nil {
+		return 0, err
+	}
+
+	return counter.count, nil
+}
+
+func (g *GridFS) file(ctx context.Context, id string) (gridfsFileInfo, error) {
+	var file gridfsFileInfo
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return file, ErrNotFound
+	}
+
+	err = g.bucket.GetFilesCollection().FindOne(ctx, bson.M{"_id": objectID}).Decode(&file)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return file, ErrNotFound
+	}
+	return file, err
+}
+
+func (g *GridFS) Get(ctx context.Context, id string, offset int64, length int64) (io.ReadCloser, error) {
+	file, err := g.file(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	end := file.Length
+	if length >= 0 && offset+length < end {
+		end = offset + length
+	}
+
+	return &gridfsChunkReader{ctx: ctx, chunks: g.bucket.GetChunksCollection(), file: file, offset: offset, end: end}, nil
+}
+
+func (g *GridFS) Delete(ctx context.Context, id string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	err = g.bucket.DeleteContext(ctx, objectID)
+	if errors.Is(err, gridfs.ErrFileNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (g *GridFS) Stat(ctx context.Context, id string) (FileInfo, error) {
+	file, err := g.file(ctx, id)
+	if err != nil {
+		return FileInfo{}, err
+	}
+
+	return FileInfo{ID: id, Size: file.Length, ModTime: file.UploadDate}, nil
+}
+
+// Reads a byte range of a GridFS file, querying the chunks collection from the chunk
+// holding the start offset so the chunks in front of it are never downloaded
+type gridfsChunkReader struct {
+	ctx       context.Context
+	chunks    *mongo.Collection
+	file      gridfsFileInfo
+	offset    int64
+	end       int64
+	cursor    *mongo.Cursor
+	nextChunk int64
+	buffer    []byte
+}
+
+func (r *gridfsChunkReader) Read(p []byte) (int, error) {
+	if r.offset >= r.end {
+		return 0, io.EOF
+	}
+
+	if len(r.buffer) == 0 {
+		if err := r.loadChunk(); err != nil {
+			return 0, err
+		}
+	}
+
+	if remaining := r.end - r.offset; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+
+	n := copy(p, r.buffer)
+	r.buffer = r.buffer[n:]
+	r.offset += int64(n)
+	return n, nil
+}
+
+func (r *gridfsChunkReader) loadChunk() error {
+	if r.cursor == nil {
+		r.nextChunk = r.offset / r.file.ChunkSize
+		cursor, err := r.chunks.Find(r.ctx,
+			bson.M{"files_id": r.file.ID, "n": bson.M{"$gte": r.nextChunk}},
+			// Small batches, a range request often needs only a few chunks
+			options.Find().SetSort(bson.M{"n": 1}).SetBatchSize(4),
+		)
+		if err != nil {
+			return err
+		}
+		r.cursor = cursor
+	}
+
+	if !r.cursor.Next(r.ctx) {
+		if err := r.cursor.Err(); err != nil {
+			return err
+		}
+		return io.ErrUnexpectedEOF
+	}
+
+	var chunk gridfsChunk
+	if err := r.cursor.Decode(&chunk); err != nil {
+		return err
+	}
+	if chunk.N != r.nextChunk {
+		return fmt.Errorf("missing GridFS chunk %d of file %s", r.nextChunk, r.file.ID.Hex())
+	}
+
+	skip := r.offset - chunk.N*r.file.ChunkSize
+	if skip < 0 || skip > int64(len(chunk.Data)) {
+		return errors.New("GridFS chunk does not contain the requested offset")
+	}
+
+	r.buffer = chunk.Data[skip:]
+	r.nextChunk++
+	return nil
+}
+
+func (r *gridfsChunkReader) Close() error {
+	if r.cursor != nil {
+		err := r.cursor.Close(r.ctx)
+		r.cursor = nil
+		return err
+	}
+	return nil
+}
+
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.count += int64(n)
+	return n, err
+}
@@ -0,0 +1,120 @@
+package Storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// Keeps blobs as plain files in a directory on the local disk
+type Local struct {
+	root string
+}
+
+// Ids become file names, so only simple names are accepted
+var localIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func NewLocal(root string) (*Local, error) {
+	if root == "" {
+		root = "media"
+	}
+
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &Local{root: root}, nil
+}
+
+func (l *Local) path(id string) (string, error) {
+	if !localIDPattern.MatchString(id) {
+		return "", ErrNotFound
+	}
+	return filepath.Join(l.root, id), nil
+}
+
+func (l *Local) Put(ctx context.Context, id string, name string, source io.Reader) (int64, error) {
+	path, err := l.path(id)
+	if err != nil {
+		return 0, err
+	}
+
+	// Write to a temporary file first so readers never see a partial blob
+	temp, err := os.CreateTemp(l.root, id+".*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(temp.Name())
+
+	size, err := io.Copy(temp, source)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return size, os.Rename(temp.Name(), path)
+}
+
+func (l *Local) Get(ctx context.Context, id string, offset int64, length int64) (io.ReadCloser, error) {
+	path, err := l.path(id)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if length < 0 {
+		return file, nil
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(file, length), file}, nil
+}
+
+func (l *Local) Delete(ctx context.Context, id string) error {
+	path, err := l.path(id)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (l *Local) Stat(ctx context.Context, id string) (FileInfo, error) {
+	path, err := l.path(id)
+	if err != nil {
+		return FileInfo{}, err
+	}
+
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return FileInfo{}, ErrNotFound
+	}
+	if err != nil {
+		return FileInfo{}, err
+	}
+
+	return FileInfo{ID: id, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
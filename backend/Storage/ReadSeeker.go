@@ -0,0 +1,76 @@
+package Storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// Adapts a backend blob to io.ReadSeeker for http.ServeContent. Seeking only moves the
+// offset, the next read asks the backend for the remaining bytes from there, so serving
+// a range never transfers the data in front of it.
+type ReadSeeker struct {
+	ctx     context.Context
+	backend Backend
+	id      string
+	size    int64
+	offset  int64
+	reader  io.ReadCloser
+}
+
+func NewReadSeeker(ctx context.Context, backend Backend, id string, size int64) *ReadSeeker {
+	return &ReadSeeker{ctx: ctx, backend: backend, id: id, size: size}
+}
+
+func (r *ReadSeeker) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+
+	if r.reader == nil {
+		reader, err := r.backend.Get(r.ctx, r.id, r.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		r.reader = reader
+	}
+
+	n, err := r.reader.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *ReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	var target int64
+	switch whence {
+	case io.SeekStart:
+		target = offset
+	case io.SeekCurrent:
+		target = r.offset + offset
+	case io.SeekEnd:
+		target = r.size + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+
+	if target < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	if target != r.offset {
+		r.Close()
+		r.offset = target
+	}
+
+	return target, nil
+}
+
+func (r *ReadSeeker) Close() error {
+	if r.reader == nil {
+		return nil
+	}
+
+	err := r.reader.Close()
+	r.reader = nil
+	return err
+}
@@ -0,0 +1,126 @@
+package Storage
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A backend holding one blob in memory that records the offsets it was read from
+type recordingBackend struct {
+	data    string
+	offsets []int64
+}
+
+func (b *recordingBackend) Put(ctx context.Context, id string, name string, source io.Reader) (int64, error) {
+	return 0, nil
+}
+
+func (b *recordingBackend) Get(ctx context.Context, id string, offset int64, length int64) (io.ReadCloser, error) {
+	b.offsets = append(b.offsets, offset)
+	return io.NopCloser(strings.NewReader(b.data[offset:])), nil
+}
+
+func (b *recordingBackend) Delete(ctx context.Context, id string) error {
+	return nil
+}
+
+func (b *recordingBackend) Stat(ctx context.Context, id string) (FileInfo, error) {
+	return FileInfo{ID: id, Size: int64(len(b.data))}, nil
+}
+
+func TestReadSeekerServesRanges(t *testing.T) {
+	content := "0123456789abcdefghij"
+
+	tests := []struct {
+		name        string
+		rangeHeader string
+		status      int
+		body        string
+		offsets     []int64
+	}{
+		{"whole file", "", http.StatusOK, content, []int64{0}},
+		{"range from the middle", "bytes=10-14", http.StatusPartialContent, "abcde", []int64{10}},
+		{"open ended range", "bytes=15-", http.StatusPartialContent, "fghij", []int64{15}},
+		{"suffix range", "bytes=-3", http.StatusPartialContent, "hij", []int64{17}},
+		{"unsatisfiable range", "bytes=50-60", http.StatusRequestedRangeNotSatisfiable, "", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			backend := &recordingBackend{data: content}
+			reader := NewReadSeeker(context.Background(), backend, "blob", int64(len(content)))
+			defer reader.Close()
+
+			request := httptest.NewRequest(http.MethodGet, "/stream", nil)
+			if test.rangeHeader != "" {
+				request.Header.Set("Range", test.rangeHeader)
+			}
+			recorder := httptest.NewRecorder()
+			// Streaming sets the type, otherwise ServeContent reads the start of the file to sniff it
+			recorder.Header().Set("Content-Type", "video/mp4")
+			http.ServeContent(recorder, request, "", time.Time{}, reader)
+
+			if recorder.Code != test.status {
+				t.Fatalf("status = %d, want %d", recorder.Code, test.status)
+			}
+			if test.status != http.StatusRequestedRangeNotSatisfiable && recorder.Body.String() != test.body {
+				t.Errorf("body = %q, want %q", recorder.Body.String(), test.body)
+			}
+			// Only the requested bytes are fetched, never the data in front of them
+			if len(backend.offsets) != len(test.offsets) {
+				t.Fatalf("backend read from %v, want %v", backend.offsets, test.offsets)
+			}
+			for i := range test.offsets {
+				if backend.offsets[i] != test.offsets[i] {
+					t.Fatalf("backend read from %v, want %v", backend.offsets, test.offsets)
+				}
+			}
+		})
+	}
+}
+
+func TestReadSeekerSeek(t *testing.T) {
+	backend := &recordingBackend{data: "0123456789"}
+	reader := NewReadSeeker(context.Background(), backend, "blob", 10)
+	defer reader.Close()
+
+	buffer := make([]byte, 2)
+	if _, err := io.ReadFull(reader, buffer); err != nil || string(buffer) != "01" {
+		t.Fatalf("first read = %q, %v", buffer, err)
+	}
+
+	seeks := []struct {
+		offset int64
+		whence int
+		want   int64
+		read   string
+	}{
+		{2, io.SeekCurrent, 4, "45"},
+		{-3, io.SeekEnd, 7, "78"},
+		{1, io.SeekStart, 1, "12"},
+	}
+	for _, seek := range seeks {
+		position, err := reader.Seek(seek.offset, seek.whence)
+		if err != nil || position != seek.want {
+			t.Fatalf("Seek(%d, %d) = %d, %v, want %d", seek.offset, seek.whence, position, err, seek.want)
+		}
+		if _, err := io.ReadFull(reader, buffer); err != nil || string(buffer) != seek.read {
+			t.Fatalf("read after Seek(%d, %d) = %q, %v, want %q", seek.offset, seek.whence, buffer, err, seek.read)
+		}
+	}
+
+	if _, err := reader.Seek(-1, io.SeekStart); err == nil {
+		t.Fatal("seeking before the start succeeded")
+	}
+	if _, err := reader.Seek(0, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := reader.Read(buffer); n != 0 || err != io.EOF {
+		t.Fatalf("read at the end = %d, %v, want io.EOF", n, err)
+	}
+}
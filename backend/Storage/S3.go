@@ -0,0 +1,281 @@
+package Storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Stores blobs in an S3-compatible object store such as AWS S3 or MinIO. Requests are
+// signed with AWS Signature Version 4 using only the standard library.
+type S3 struct {
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	pathStyle bool // MinIO and most self-hosted stores address buckets in the path
+	client    *http.Client
+	now       func() time.Time
+}
+
+func NewS3(endpoint string, region string, bucket string, accessKey string, secretKey string, pathStyle bool) (*S3, error) {
+	if endpoint == "" || bucket == "" {
+		return nil, errors.New("S3 endpoint and bucket are required")
+	}
+
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	return &S3{
+		endpoint:  parsed,
+		region:    region,
+		bucket:    bucket,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		pathStyle: pathStyle,
+		client:    &http.Client{},
+		now:       time.Now,
+	}, nil
+}
+
+// Opens the store configured by the S3_* variables. The bucket is created when it is missing,
+// unless S3_CREATE_BUCKET is false.
+func NewS3FromEnv() (*S3, error) {
+	pathStyle := os.Getenv("S3_PATH_STYLE") != "false"
+	store, err := NewS3(
+		os.Getenv("S3_ENDPOINT"),
+		os.Getenv("S3_REGION"),
+		os.Getenv("S3_BUCKET"),
+		os.Getenv("S3_ACCESS_KEY"),
+		os.Getenv("S3_SECRET_KEY"),
+		pathStyle,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := store.EnsureBucket(ctx, os.Getenv("S3_CREATE_BUCKET") != "false"); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// Checks that the bucket exists and can be used, so a wrong configuration shows up on startup
+// instead of on the first upload. A missing bucket is created when create is set.
+func (s *S3) EnsureBucket(ctx context.Context, create bool) error {
+	response, err := s.do(ctx, http.MethodHead, "", nil, sha256Hex(nil), 0, nil)
+	if err == nil {
+		return response.Body.Close()
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("S3 bucket %q is not accessible: %w", s.bucket, err)
+	}
+	if !create {
+		return fmt.Errorf("S3 bucket %q does not exist", s.bucket)
+	}
+
+	// Buckets outside us-east-1 have to name their region
+	var body []byte
+	if s.region != "us-east-1" {
+		body = []byte(`<CreateBucketConfiguration xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><LocationConstraint>` +
+			s.region + `</LocationConstraint></CreateBucketConfiguration>`)
+	}
+	response, err = s.do(ctx, http.MethodPut, "", bytes.NewReader(body), sha256Hex(body), int64(len(body)), nil)
+	if err != nil {
+		return fmt.Errorf("creating S3 bucket %q: %w", s.bucket, err)
+	}
+	return response.Body.Close()
+}
+
+// URL of an object, an empty id addresses the bucket itself
+func (s *S3) objectURL(id string) *url.URL {
+	object := *s.endpoint
+	if s.pathStyle {
+		object.Path = strings.TrimSuffix(object.Path, "/") + "/" + s.bucket
+	} else {
+		object.Host = s.bucket + "." + object.Host
+		object.Path = strings.TrimSuffix(object.Path, "/")
+	}
+	if id != "" || !s.pathStyle {
+		object.Path += "/" + url.PathEscape(id)
+	}
+	return &object
+}
+
+// Signs a request with AWS Signature Version 4, payloadHash is the hex SHA-256 of the body
+func (s *S3) sign(request *http.Request, payloadHash string) {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	request.Header.Set("x-amz-date", amzDate)
+	request.Header.Set("x-amz-content-sha256", payloadHash)
+
+	canonicalHeaders := "host:" + request.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		request.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	signingKey := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	signingKey = hmacSHA256(signingKey, s.region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	request.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature,
+	))
+}
+
+func (s *S3) do(ctx context.Context, method string, id string, body io.Reader, payloadHash string, size int64, headers map[string]string) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, method, s.objectURL(id).String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		request.ContentLength = size
+	}
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+	s.sign(request, payloadHash)
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode == http.StatusNotFound {
+		response.Body.Close()
+		return nil, ErrNotFound
+	}
+	if response.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+		response.Body.Close()
+		return nil, fmt.Errorf("S3 %s %s failed with %s: %s", method, id, response.Status, strings.TrimSpace(string(message)))
+	}
+
+	return response, nil
+}
+
+func (s *S3) Put(ctx context.Context, id string, name string, source io.Reader) (int64, error) {
+	// Signed uploads need the length and hash up front, so the stream is spooled to disk first
+	temp, err := os.CreateTemp("", "s3-upload-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(temp.Name())
+	defer temp.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(temp, hash), source)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := temp.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	headers := map[string]string{"Content-Type": "application/octet-stream"}
+	response, err := s.do(ctx, http.MethodPut, id, temp, hex.EncodeToString(hash.Sum(nil)), size, headers)
+	if err != nil {
+		return 0, err
+	}
+	response.Body.Close()
+
+	return size, nil
+}
+
+func (s *S3) Get(ctx context.Context, id string, offset int64, length int64) (io.ReadCloser, error) {
+	headers := map[string]string{}
+	if length >= 0 {
+		if length == 0 {
+			return io.NopCloser(strings.NewReader("")), nil
+		}
+		headers["Range"] = fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+	} else if offset > 0 {
+		headers["Range"] = fmt.Sprintf("bytes=%d-", offset)
+	}
+
+	response, err := s.do(ctx, http.MethodGet, id, nil, sha256Hex(nil), 0, headers)
+	if err != nil {
+		return nil, err
+	}
+
+	return response.Body, nil
+}
+
+func (s *S3) Delete(ctx context.Context, id string) error {
+	if _, err := s.Stat(ctx, id); err != nil {
+		return err
+	}
+
+	response, err := s.do(ctx, http.MethodDelete, id, nil, sha256Hex(nil), 0, nil)
+	if err != nil {
+		return err
+	}
+	return response.Body.Close()
+}
+
+func (s *S3) Stat(ctx context.Context, id string) (FileInfo, error) {
+	response, err := s.do(ctx, http.MethodHead, id, nil, sha256Hex(nil), 0, nil)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	response.Body.Close()
+
+	size := response.ContentLength
+	if size < 0 {
+		return FileInfo{}, fmt.Errorf("missing Content-Length for %s", id)
+	}
+
+	modTime, _ := http.ParseTime(response.Header.Get("Last-Modified"))
+
+	return FileInfo{ID: id, Size: size, ModTime: modTime}, nil
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,92 @@
+package Storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+type FileInfo struct {
+	ID      string
+	Size    int64
+	ModTime time.Time
+}
+
+// A place to keep media blobs. Ids are chosen by the caller, so a blob keeps its id
+// when it is moved to a different backend.
+type Backend interface {
+	// Stores the stream under id, name is a human readable label where the backend supports one
+	Put(ctx context.Context, id string, name string, source io.Reader) (int64, error)
+	// Opens length bytes starting at offset, a negative length reads to the end
+	Get(ctx context.Context, id string, offset int64, length int64) (io.ReadCloser, error)
+	Delete(ctx context.Context, id string) error
+	Stat(ctx context.Context, id string) (FileInfo, error)
+}
+
+var (
+	defaultBackend Backend
+	defaultErr     error
+	defaultOnce    sync.Once
+)
+
+// Returns the backend selected by STORAGE_BACKEND (gridfs, local or s3), gridfs when unset
+func Default() (Backend, error) {
+	defaultOnce.Do(func() {
+		defaultBackend, defaultErr = New(os.Getenv("STORAGE_BACKEND"))
+	})
+	return defaultBackend, defaultErr
+}
+
+func New(name string) (Backend, error) {
+	switch name {
+	case "", "gridfs":
+		return NewGridFS()
+	case "local":
+		return NewLocal(os.Getenv("STORAGE_LOCAL_PATH"))
+	case "s3":
+		return NewS3FromEnv()
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", name)
+	}
+}
+
+// Generates an id for a new blob, ObjectID hex strings are valid in every backend
+func NewID() string {
+	return primitive.NewObjectID().Hex()
+}
+
+// Copies a blob between backends unless the target already holds it
+func Copy(ctx context.Context, from Backend, to Backend, id string, name string) (bool, error) {
+	source, err := from.Stat(ctx, id)
+	if err != nil {
+		return false, err
+	}
+
+	if target, err := to.Stat(ctx, id); err == nil && target.Size == source.Size {
+		return false, nil
+	}
+
+	reader, err := from.Get(ctx, id, 0, -1)
+	if err != nil {
+		return false, err
+	}
+	defer reader.Close()
+
+	size, err := to.Put(ctx, id, name, reader)
+	if err != nil {
+		return false, err
+	}
+	if size != source.Size {
+		return false, fmt.Errorf("copied %d of %d bytes of %s", size, source.Size, id)
+	}
+
+	return true, nil
+}
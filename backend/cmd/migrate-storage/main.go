@@ -0,0 +1,115 @@
+// Copies every stored video and poster image between media storage backends, for example before switching
+// STORAGE_BACKEND from gridfs to s3:
+//
+//	go run ./cmd/migrate-storage -from gridfs -to s3
+//
+// Blobs keep their ids, so the video metadata needs no changes. Blobs already present in
+// the target with the same size are skipped, which makes the migration safe to re-run.
+package main
+
+import (
+	"backend/Mongo"
+	"backend/Storage"
+	"context"
+	"flag"
+	"log"
+
+	"github.com/joho/godotenv"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func main() {
+	from := flag.String("from", "gridfs", "source backend (gridfs, local or s3)")
+	to := flag.String("to", "", "target backend (gridfs, local or s3)")
+	deleteSource := flag.Bool("delete", false, "delete each blob from the source after it was copied")
+	dryRun := flag.Bool("dry-run", false, "only list the blobs that would be copied")
+	flag.Parse()
+
+	if *to == "" || *to == *from {
+		log.Fatal("-to is required and must differ from -from")
+	}
+
+	_ = godotenv.Load("/root/.env")
+	Mongo.ConnectToMongoDB()
+
+	source, err := Storage.New(*from)
+	if err != nil {
+		log.Fatalf("Error opening source backend: %v", err)
+	}
+	target, err := Storage.New(*to)
+	if err != nil {
+		log.Fatalf("Error opening target backend: %v", err)
+	}
+
+	ctx := context.Background()
+	cursor, err := Mongo.GetCollection("videostore").Find(ctx, bson.M{})
+	if err != nil {
+		log.Fatalf("Error querying video metadata: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	copied, skipped, failed := 0, 0, 0
+	seen := make(map[string]bool)
+	for cursor.Next(ctx) {
+		var video struct {
+			VideoID   string `bson:"video_id"`
+			BlobID    string `bson:"blob_id"`
+			VideoName string `bson:"video_name"`
+			Poster    struct {
+				Variants map[string]string `bson:"variants"`
+			} `bson:"poster"`
+		}
+		if err := cursor.Decode(&video); err != nil {
+			log.Printf("Error decoding video metadata: %v", err)
+			failed++
+			continue
+		}
+
+		// Deduplicated videos share a blob, older videos store it under their own id
+		blobID := video.BlobID
+		if blobID == "" {
+			blobID = video.VideoID
+		}
+		names := map[string]string{blobID: video.VideoName}
+		for size, posterID := range video.Poster.Variants {
+			names[posterID] = video.VideoName + "_poster_" + size + ".jpg"
+		}
+
+		for id, name := range names {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+
+			if *dryRun {
+				log.Printf("Would copy %s (%s)", id, name)
+				continue
+			}
+
+			didCopy, err := Storage.Copy(ctx, source, target, id, name)
+			if err != nil {
+				log.Printf("Error copying %s: %v", id, err)
+				failed++
+				continue
+			}
+
+			if didCopy {
+				copied++
+			} else {
+				skipped++
+			}
+
+			if *deleteSource {
+				if err := source.Delete(ctx, id); err != nil {
+					log.Printf("Error deleting %s from source: %v", id, err)
+				}
+			}
+		}
+	}
+
+	if err := cursor.Err(); err != nil {
+		log.Fatalf("Cursor error: %v", err)
+	}
+
+	log.Printf("Migration finished: %d copied, %d already present, %d failed", copied, skipped, failed)
+}
@@ -0,0 +1,28 @@
+// Lowercases and deduplicates the tags of videos uploaded before tags were normalized. Tag
+// queries are lowercased, so until this has run such videos can not be found by their tags:
+//
+//	go run ./cmd/migrate-tags
+//
+// Videos whose tags are already normalized are left alone, which makes the migration safe to re-run.
+package main
+
+import (
+	"backend/Functions"
+	"backend/Mongo"
+	"context"
+	"log"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	_ = godotenv.Load("/root/.env")
+	Mongo.ConnectToMongoDB()
+
+	updated, err := Functions.NormalizeStoredTags(context.Background())
+	if err != nil {
+		log.Fatalf("Error normalizing tags after %d videos: %v", updated, err)
+	}
+
+	log.Printf("Migration finished: tags of %d videos normalized", updated)
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"backend/Functions"
 	"backend/HTTP"
 	"backend/Mongo"
+	"backend/Realtime"
+	"backend/Storage"
+	"log"
 	"os"
 
 	"github.com/gin-contrib/cors"
@@ -22,13 +26,19 @@ func main() {
 	}
 
 	//var endpointRouter = HTTP.Routes{} // Inicializacija router-jev za endpoint-e
-	Mongo.ConnectToMongoDB() // Vzpostavitev povezave s podatkovno bazo MongoDB
+	Mongo.ConnectToMongoDB()           // Vzpostavitev povezave s podatkovno bazo MongoDB
+	Realtime.Start()                   // Posredovanje sprememb v realnem času prijavljenim odjemalcem
+	Functions.StartUploadCleanup()     // Brisanje nedokončanih nalaganj videov
+	Functions.StartViewWindowCleanup() // Brisanje pretečenih oken za štetje ogledov
+	if _, err := Storage.Default(); err != nil {
+		log.Fatalf("Error opening media storage: %v", err) // Napačno nastavljena shramba se pokaže ob zagonu
+	}
 	router := gin.Default()
 	router.Use(cors.New(cors.Config{
 		AllowAllOrigins:  true,
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowMethods:     []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "Range", "If-Range", "If-None-Match", "If-Modified-Since", "Tus-Resumable", "Upload-Length", "Upload-Offset", "Upload-Metadata"},
+		ExposeHeaders:    []string{"Content-Length", "Content-Range", "Accept-Ranges", "ETag", "Last-Modified", "Location", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size", "Upload-Offset", "Upload-Length", "Upload-Expires", "Upload-Video-Id", "Upload-Video-Sha256", "X-Content-SHA256", "X-Playlist-Video-Id"},
 		AllowCredentials: true,
 	}))
 